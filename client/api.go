@@ -1,22 +1,39 @@
 package client
 
 import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/Gewinum/go-df-discord/server"
 	"github.com/go-resty/resty/v2"
 	"github.com/go-viper/mapstructure/v2"
+	"io"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 type Api struct {
-	host        string
-	accessToken string
+	host          string
+	accessToken   string
+	signingSecret []byte
 }
 
 func NewApi(host, accessToken string) (*Api, error) {
-	inst := &Api{host, accessToken}
+	inst := &Api{host: host, accessToken: accessToken}
+	if !inst.Test() {
+		return nil, errors.New(fmt.Sprintf("can't access %s", host))
+	}
+	return inst, nil
+}
+
+// NewSignedApi signs every request with the secret instead of sending a
+// token, for servers configured with Opts.SigningSecret.
+func NewSignedApi(host string, signingSecret []byte) (*Api, error) {
+	inst := &Api{host: host, signingSecret: signingSecret}
 	if !inst.Test() {
 		return nil, errors.New(fmt.Sprintf("can't access %s", host))
 	}
@@ -31,10 +48,10 @@ func (a *Api) Test() bool {
 	return resp.StatusCode() == http.StatusOK
 }
 
-func (a *Api) IssueCode(xuid string) (*server.CodeInformation, error) {
+func (a *Api) IssueCode(xuid, gamertag string) (*server.CodeInformation, error) {
 	var responsePayload server.Payload
 	var response server.CodeInformation
-	resp, err := a.getRequest().SetBody(xuid).Post(a.host + "/codes/issue")
+	resp, err := a.getRequest().SetBody(server.IssueCodeRequest{XUID: xuid, Gamertag: gamertag}).Post(a.host + "/v1/codes/issue")
 	if err != nil {
 		return nil, err
 	}
@@ -45,7 +62,7 @@ func (a *Api) IssueCode(xuid string) (*server.CodeInformation, error) {
 	if responsePayload.Error != nil {
 		return nil, errors.New(responsePayload.Error.Message)
 	}
-	err = mapstructure.Decode(responsePayload.Data, &response)
+	err = decodeData(responsePayload.Data, &response)
 	if err != nil {
 		return nil, err
 	}
@@ -53,9 +70,15 @@ func (a *Api) IssueCode(xuid string) (*server.CodeInformation, error) {
 }
 
 func (a *Api) CheckCode(code string) (*server.CodeInformation, error) {
+	return a.CheckCodeFor(code, "")
+}
+
+// CheckCodeFor checks a code that should belong to the given XUID, so wrong
+// codes count towards the guess limit of that account.
+func (a *Api) CheckCodeFor(code, xuid string) (*server.CodeInformation, error) {
 	var responsePayload server.Payload
 	var response server.CodeInformation
-	resp, err := a.getRequest().SetBody(code).Post(a.host + "/codes/check")
+	resp, err := a.getRequest().SetBody(server.CheckCodeRequest{Code: code, XUID: xuid}).Post(a.host + "/v1/codes/check")
 	if err != nil {
 		return nil, err
 	}
@@ -66,7 +89,7 @@ func (a *Api) CheckCode(code string) (*server.CodeInformation, error) {
 	if responsePayload.Error != nil {
 		return nil, errors.New(responsePayload.Error.Message)
 	}
-	err = mapstructure.Decode(responsePayload.Data, &response)
+	err = decodeData(responsePayload.Data, &response)
 	if err != nil {
 		return nil, err
 	}
@@ -77,7 +100,7 @@ func (a *Api) CheckCode(code string) (*server.CodeInformation, error) {
 func (a *Api) RevokeCode(code string) (*server.CodeInformation, error) {
 	var responsePayload server.Payload
 	var response server.CodeInformation
-	resp, err := a.getRequest().SetBody(code).Post(a.host + "/codes/revoke")
+	resp, err := a.getRequest().SetBody(server.CodeRequest{Code: code}).Post(a.host + "/v1/codes/revoke")
 	if err != nil {
 		return nil, err
 	}
@@ -88,7 +111,7 @@ func (a *Api) RevokeCode(code string) (*server.CodeInformation, error) {
 	if responsePayload.Error != nil {
 		return nil, errors.New(responsePayload.Error.Message)
 	}
-	err = mapstructure.Decode(responsePayload.Data, &response)
+	err = decodeData(responsePayload.Data, &response)
 	if err != nil {
 		return nil, err
 	}
@@ -98,7 +121,7 @@ func (a *Api) RevokeCode(code string) (*server.CodeInformation, error) {
 func (a *Api) GetUserByDiscord(discordId string) (*server.User, error) {
 	var responsePayload server.Payload
 	var response server.User
-	resp, err := a.getRequest().SetPathParams(map[string]string{"{discord}": discordId}).Get(a.host + "/users/discord/{discord}")
+	resp, err := a.getRequest().SetPathParams(map[string]string{"discord": discordId}).Get(a.host + "/v1/users/discord/{discord}")
 	if err != nil {
 		return nil, err
 	}
@@ -109,7 +132,7 @@ func (a *Api) GetUserByDiscord(discordId string) (*server.User, error) {
 	if responsePayload.Error != nil {
 		return nil, errors.New(responsePayload.Error.Message)
 	}
-	err = mapstructure.Decode(responsePayload.Data, &response)
+	err = decodeData(responsePayload.Data, &response)
 	if err != nil {
 		return nil, err
 	}
@@ -119,7 +142,30 @@ func (a *Api) GetUserByDiscord(discordId string) (*server.User, error) {
 func (a *Api) GetUserByXUID(xuid string) (*server.User, error) {
 	var responsePayload server.Payload
 	var response server.User
-	resp, err := a.getRequest().SetPathParams(map[string]string{"xuid": xuid}).Get(a.host + "/users/xuid/{xuid}")
+	resp, err := a.getRequest().SetPathParams(map[string]string{"xuid": xuid}).Get(a.host + "/v1/users/xuid/{xuid}")
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(resp.Body(), &responsePayload)
+	if err != nil {
+		return nil, err
+	}
+	if responsePayload.Error != nil {
+		return nil, errors.New(responsePayload.Error.Message)
+	}
+	err = decodeData(responsePayload.Data, &response)
+	if err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// UpdateGamertag reports the current gamertag of a bound player, so the bot
+// can refresh their nickname.
+func (a *Api) UpdateGamertag(xuid, gamertag string) (*server.User, error) {
+	var responsePayload server.Payload
+	var response server.User
+	resp, err := a.getRequest().SetPathParams(map[string]string{"xuid": xuid}).SetBody(server.UpdateGamertagRequest{Gamertag: gamertag}).Put(a.host + "/v1/users/xuid/{xuid}/gamertag")
 	if err != nil {
 		return nil, err
 	}
@@ -130,13 +176,84 @@ func (a *Api) GetUserByXUID(xuid string) (*server.User, error) {
 	if responsePayload.Error != nil {
 		return nil, errors.New(responsePayload.Error.Message)
 	}
-	err = mapstructure.Decode(responsePayload.Data, &response)
+	err = decodeData(responsePayload.Data, &response)
 	if err != nil {
 		return nil, err
 	}
 	return &response, nil
 }
 
+func (a *Api) UnbindByDiscord(discordId string) error {
+	var responsePayload server.Payload
+	resp, err := a.getRequest().SetPathParams(map[string]string{"discord": discordId}).Delete(a.host + "/v1/users/discord/{discord}")
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(resp.Body(), &responsePayload)
+	if err != nil {
+		return err
+	}
+	if responsePayload.Error != nil {
+		return errors.New(responsePayload.Error.Message)
+	}
+	return nil
+}
+
+func (a *Api) UnbindByXUID(xuid string) error {
+	var responsePayload server.Payload
+	resp, err := a.getRequest().SetPathParams(map[string]string{"xuid": xuid}).Delete(a.host + "/v1/users/xuid/{xuid}")
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(resp.Body(), &responsePayload)
+	if err != nil {
+		return err
+	}
+	if responsePayload.Error != nil {
+		return errors.New(responsePayload.Error.Message)
+	}
+	return nil
+}
+
 func (a *Api) getRequest() *resty.Request {
-	return resty.New().R().SetHeader("Authorization", a.accessToken)
+	client := resty.New()
+	if a.signingSecret != nil {
+		return client.SetPreRequestHook(a.sign).R()
+	}
+	return client.R().SetAuthToken(a.accessToken)
+}
+
+// sign runs once the body is serialized, right before the request is sent.
+func (a *Api) sign(_ *resty.Client, req *http.Request) error {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		if err != nil {
+			return err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	nonce := make([]byte, 16)
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return err
+	}
+	timestamp := time.Now().Unix()
+	encodedNonce := hex.EncodeToString(nonce)
+	req.Header.Set(server.HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(server.HeaderNonce, encodedNonce)
+	req.Header.Set(server.HeaderSignature, server.Signature(a.signingSecret, req.Method, req.URL.RequestURI(), body, timestamp, encodedNonce))
+	return nil
+}
+
+func decodeData(data interface{}, out interface{}) error {
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook: mapstructure.StringToTimeHookFunc(time.RFC3339),
+		Result:     out,
+	})
+	if err != nil {
+		return err
+	}
+	return decoder.Decode(data)
 }
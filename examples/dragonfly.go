@@ -10,6 +10,7 @@ import (
 	"github.com/pelletier/go-toml/v2"
 	"github.com/sirupsen/logrus"
 	"os"
+	"time"
 )
 
 var apiInstance *client.Api
@@ -23,12 +24,29 @@ func (c BindCommand) Run(source cmd.Source, output *cmd.Output) {
 		output.Printf("You must run this command as a player")
 		return
 	}
-	codeInfo, err := apiInstance.IssueCode(plr.XUID())
+	codeInfo, err := apiInstance.IssueCode(plr.XUID(), plr.Name())
 	if err != nil {
 		output.Printf(err.Error())
 		return
 	}
-	output.Printf("Your code is %s", codeInfo.Code)
+	output.Printf("Your code is %s, it expires in %s", codeInfo.Code, time.Until(codeInfo.Expires).Round(time.Second))
+}
+
+type UnbindCommand struct {
+}
+
+func (c UnbindCommand) Run(source cmd.Source, output *cmd.Output) {
+	plr, ok := source.(*player.Player)
+	if !ok {
+		output.Printf("You must run this command as a player")
+		return
+	}
+	err := apiInstance.UnbindByXUID(plr.XUID())
+	if err != nil {
+		output.Printf(err.Error())
+		return
+	}
+	output.Printf("Your discord account has been unbound")
 }
 
 func main() {
@@ -39,6 +57,7 @@ func main() {
 	apiInstance = api
 
 	cmd.Register(cmd.New("bind", "Bind your discord account to minecraft", make([]string, 0), BindCommand{}))
+	cmd.Register(cmd.New("unbind", "Unbind your discord account from minecraft", make([]string, 0), UnbindCommand{}))
 
 	logger := logrus.New()
 	logger.Formatter = &logrus.TextFormatter{ForceColors: true}
@@ -55,7 +74,10 @@ func main() {
 	srv.CloseOnProgramEnd()
 
 	srv.Listen()
-	for srv.Accept(nil) {
+	for srv.Accept(func(p *player.Player) {
+		// Keeps the discord nickname in sync with the current gamertag.
+		go apiInstance.UpdateGamertag(p.XUID(), p.Name())
+	}) {
 	}
 }
 
@@ -2,6 +2,7 @@ package main
 
 import (
 	"github.com/Gewinum/go-df-discord/server"
+	"github.com/bwmarrin/discordgo"
 	"log/slog"
 	"os"
 	"os/signal"
@@ -14,8 +15,21 @@ func main() {
 	signal.Notify(sgn, os.Interrupt, syscall.SIGTERM, syscall.SIGINT)
 	srv := server.NewServer("aaaa-bbb-cc", "token", &server.Opts{
 		Logger: logger,
+		Database: &server.DatabaseConfig{
+			Driver: server.DriverSQLite,
+			DSN:    "bindings.db",
+		},
 	})
-	srv.Bot().RegisterCommands("leave-empty-if-global")
+	srv.Bot().AddCommand(&discordgo.ApplicationCommand{
+		Name:        "rules",
+		Description: "Show the server rules",
+	}, func(i *discordgo.InteractionCreate, options map[string]*discordgo.ApplicationCommandInteractionDataOption) *discordgo.InteractionResponseData {
+		return &discordgo.InteractionResponseData{Content: "Be nice to each other"}
+	})
+	err := srv.Bot().SyncCommands("leave-empty-if-global")
+	if err != nil {
+		logger.Error("Could not sync commands", "error", err)
+	}
 	go func() {
 		err := srv.ServeWeb(":8080")
 		if err != nil {
@@ -24,4 +38,5 @@ func main() {
 	}()
 	<-sgn
 	logger.Info("Shutting the server down")
+	_ = srv.Bot().Close(false)
 }
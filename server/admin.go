@@ -0,0 +1,255 @@
+package server
+
+import (
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"slices"
+	"strings"
+)
+
+// maxCodeListLength keeps the code list below discord's embed description limit.
+const maxCodeListLength = 4000
+
+func (b *Bot) addAdminCommands() {
+	manageGuild := int64(discordgo.PermissionManageGuild)
+	b.AddCommand(&discordgo.ApplicationCommand{
+		Name:                     "admin",
+		Description:              "Manage bindings and codes",
+		DefaultMemberPermissions: &manageGuild,
+		Contexts:                 guildContext,
+		IntegrationTypes:         guildInstall,
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "bind",
+				Description: "Bind a minecraft account to a discord member",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionUser,
+						Name:        "user",
+						Description: "discord member to bind",
+						Required:    true,
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "xuid",
+						Description: "XUID of the minecraft account",
+						Required:    true,
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "gamertag",
+						Description: "gamertag of the minecraft account",
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "unbind",
+				Description: "Remove the binding of a discord member",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionUser,
+						Name:        "user",
+						Description: "discord member to unbind",
+						Required:    true,
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "unbind-xuid",
+				Description: "Remove the binding of a minecraft account",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "xuid",
+						Description: "XUID of the minecraft account",
+						Required:    true,
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommandGroup,
+				Name:        "codes",
+				Description: "Manage outstanding codes",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Name:        "list",
+						Description: "List codes waiting to be redeemed",
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionSubCommand,
+						Name:        "revoke",
+						Description: "Revoke a code",
+						Options: []*discordgo.ApplicationCommandOption{
+							{
+								Type:        discordgo.ApplicationCommandOptionString,
+								Name:        "code",
+								Description: "code to revoke",
+								Required:    true,
+							},
+						},
+					},
+				},
+			},
+		},
+	}, b.adminOnly(nil))
+	b.AddSubcommand("admin bind", b.adminOnly(b.adminBind))
+	b.AddSubcommand("admin unbind", b.adminOnly(b.adminUnbind))
+	b.AddSubcommand("admin unbind-xuid", b.adminOnly(b.adminUnbindXUID))
+	b.AddSubcommand("admin codes list", b.adminOnly(b.adminListCodes))
+	b.AddSubcommand("admin codes revoke", b.adminOnly(b.adminRevokeCode))
+}
+
+// adminOnly rejects members without Opts.AdminRole. The command permission
+// alone isn't enough, guild admins can grant it to anyone.
+func (b *Bot) adminOnly(handler CustomCommandHandler) CustomCommandHandler {
+	return func(i *discordgo.InteractionCreate, options map[string]*discordgo.ApplicationCommandInteractionDataOption) *discordgo.InteractionResponseData {
+		lang := interactionLanguage(i)
+		if !b.isAdmin(i.Member) || handler == nil {
+			return messageResponse(tr(lang, "admin_forbidden"))
+		}
+		return handler(i, options)
+	}
+}
+
+func (b *Bot) isAdmin(member *discordgo.Member) bool {
+	if member == nil {
+		return false
+	}
+	return b.opts.AdminRole == "" || slices.Contains(member.Roles, b.opts.AdminRole)
+}
+
+func (b *Bot) adminBind(i *discordgo.InteractionCreate, options map[string]*discordgo.ApplicationCommandInteractionDataOption) *discordgo.InteractionResponseData {
+	lang := interactionLanguage(i)
+	discordId := options["user"].UserValue(nil).ID
+	xuid := options["xuid"].StringValue()
+	var gamertag string
+	if opt, ok := options["gamertag"]; ok {
+		gamertag = opt.StringValue()
+	}
+	user, err := b.service.CreateUser(discordId, xuid, gamertag)
+	b.audit(i, "bind", err,
+		&discordgo.MessageEmbedField{Name: "Discord", Value: "<@" + discordId + ">", Inline: true},
+		&discordgo.MessageEmbedField{Name: "XUID", Value: xuid, Inline: true},
+	)
+	if err != nil {
+		return errorResponse(lang, err)
+	}
+	return userEmbedResponse(lang, tr(lang, "bind_created"), colorSuccess, user)
+}
+
+func (b *Bot) adminUnbind(i *discordgo.InteractionCreate, options map[string]*discordgo.ApplicationCommandInteractionDataOption) *discordgo.InteractionResponseData {
+	discordId := options["user"].UserValue(nil).ID
+	user, err := b.service.GetUserByDiscord(discordId)
+	if err == nil {
+		err = b.service.DeleteUserByDiscord(user.Discord)
+	}
+	requested := &discordgo.MessageEmbedField{Name: "Discord", Value: "<@" + discordId + ">", Inline: true}
+	return b.adminUnbindResponse(i, requested, user, err)
+}
+
+func (b *Bot) adminUnbindXUID(i *discordgo.InteractionCreate, options map[string]*discordgo.ApplicationCommandInteractionDataOption) *discordgo.InteractionResponseData {
+	xuid := options["xuid"].StringValue()
+	user, err := b.service.GetUserByXUID(xuid)
+	if err == nil {
+		err = b.service.DeleteUserByXUID(user.XUID)
+	}
+	requested := &discordgo.MessageEmbedField{Name: "XUID", Value: xuid, Inline: true}
+	return b.adminUnbindResponse(i, requested, user, err)
+}
+
+// adminUnbindResponse audits the unbind, naming the requested account when
+// it failed.
+func (b *Bot) adminUnbindResponse(i *discordgo.InteractionCreate, requested *discordgo.MessageEmbedField, user *User, err error) *discordgo.InteractionResponseData {
+	lang := interactionLanguage(i)
+	if err != nil {
+		b.audit(i, "unbind", err, requested)
+		return errorResponse(lang, err)
+	}
+	b.audit(i, "unbind", nil,
+		&discordgo.MessageEmbedField{Name: "Discord", Value: "<@" + user.Discord + ">", Inline: true},
+		&discordgo.MessageEmbedField{Name: "XUID", Value: user.XUID, Inline: true},
+	)
+	return userEmbedResponse(lang, tr(lang, "unbind_removed"), colorSuccess, user)
+}
+
+func (b *Bot) adminListCodes(i *discordgo.InteractionCreate, options map[string]*discordgo.ApplicationCommandInteractionDataOption) *discordgo.InteractionResponseData {
+	lang := interactionLanguage(i)
+	codes, err := b.service.ListCodes()
+	b.audit(i, "codes list", err)
+	if err != nil {
+		return errorResponse(lang, err)
+	}
+	if len(codes) == 0 {
+		return messageResponse(tr(lang, "admin_codes_empty"))
+	}
+
+	var description strings.Builder
+	for n, info := range codes {
+		gamertag := info.Gamertag
+		if gamertag == "" {
+			gamertag = tr(lang, "unknown")
+		}
+		line := fmt.Sprintf("`%s` %s (%s), <t:%d:R>\n", info.Code, gamertag, info.XUID, info.Expires.Unix())
+		if description.Len()+len(line) > maxCodeListLength {
+			description.WriteString(fmt.Sprintf(tr(lang, "admin_codes_more"), len(codes)-n))
+			break
+		}
+		description.WriteString(line)
+	}
+	response := messageResponse("")
+	response.Embeds = []*discordgo.MessageEmbed{{
+		Title:       tr(lang, "admin_codes_title"),
+		Color:       colorInfo,
+		Description: description.String(),
+	}}
+	return response
+}
+
+func (b *Bot) adminRevokeCode(i *discordgo.InteractionCreate, options map[string]*discordgo.ApplicationCommandInteractionDataOption) *discordgo.InteractionResponseData {
+	lang := interactionLanguage(i)
+	code := strings.ToUpper(options["code"].StringValue())
+	err := b.service.RevokeCode(code)
+	b.audit(i, "codes revoke", err,
+		&discordgo.MessageEmbedField{Name: "Code", Value: code, Inline: true},
+	)
+	if err != nil {
+		return errorResponse(lang, err)
+	}
+	return messageResponse(fmt.Sprintf(tr(lang, "admin_code_revoked"), code))
+}
+
+// audit logs an /admin action and reports it to Opts.AuditChannelID. The
+// report is sent in the background so the interaction is answered in time.
+func (b *Bot) audit(i *discordgo.InteractionCreate, action string, err error, fields ...*discordgo.MessageEmbedField) {
+	moderator := invokingUser(i)
+	args := []any{"action", action, "moderator", moderator.ID}
+	for _, field := range fields {
+		args = append(args, strings.ToLower(field.Name), field.Value)
+	}
+	color := colorSuccess
+	if err != nil {
+		args = append(args, "error", err)
+		color = colorDanger
+		fields = append(fields, &discordgo.MessageEmbedField{Name: "Error", Value: err.Error()})
+	}
+	b.opts.Logger.Info("Admin action", args...)
+	if b.opts.AuditChannelID == "" {
+		return
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:  "/admin " + action,
+		Color:  color,
+		Fields: append([]*discordgo.MessageEmbedField{{Name: "Moderator", Value: "<@" + moderator.ID + ">"}}, fields...),
+	}
+	go func() {
+		_, err := b.api.ChannelMessageSendEmbed(b.opts.AuditChannelID, embed)
+		if err != nil {
+			b.opts.Logger.Error("Could not send audit log message", "action", action, "error", err)
+		}
+	}()
+}
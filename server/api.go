@@ -0,0 +1,172 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Gewinum/go-df-discord/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+type IssueCodeRequest struct {
+	XUID     string `json:"xuid" binding:"required,numeric"`
+	Gamertag string `json:"gamertag"`
+}
+
+// CodeRequest is the body of the revoke endpoint.
+type CodeRequest struct {
+	Code string `json:"code" binding:"required,alphanum"`
+}
+
+// CheckCodeRequest is the body of the check endpoint. Naming the XUID the
+// code should belong to counts wrong codes towards Opts.CodeGuessLimit.
+type CheckCodeRequest struct {
+	Code string `json:"code" binding:"required,alphanum"`
+	XUID string `json:"xuid" binding:"omitempty,numeric"`
+}
+
+type UpdateGamertagRequest struct {
+	Gamertag string `json:"gamertag" binding:"required"`
+}
+
+// registerV1 adds the routes of the versioned API, which take JSON bodies.
+func (s *Server) registerV1(r gin.IRouter) {
+	r.POST("/codes/issue", requireScope(ScopeCodesIssue), func(c *gin.Context) {
+		var req IssueCodeRequest
+		bindJSON(c, &req)
+		info, err := s.service.IssueCode(req.XUID, req.Gamertag)
+		utils.ErrorPanic(err)
+		c.JSON(http.StatusOK, SuccessPayload(info))
+	})
+
+	r.POST("/codes/check", requireScope(ScopeCodesRead), func(c *gin.Context) {
+		var req CheckCodeRequest
+		bindJSON(c, &req)
+		var info *CodeInformation
+		s.guardCodeAttempt(c, req.Code, func() (err error) {
+			info, err = s.service.CheckCodeFor(req.Code, req.XUID)
+			return err
+		})
+		c.JSON(http.StatusOK, SuccessPayload(info))
+	})
+
+	r.POST("/codes/revoke", requireScope(ScopeCodesRevoke), func(c *gin.Context) {
+		var req CodeRequest
+		bindJSON(c, &req)
+		s.guardCodeAttempt(c, req.Code, func() error {
+			return s.service.RevokeCode(req.Code)
+		})
+		c.JSON(http.StatusOK, SuccessPayload(nil))
+	})
+
+	r.PUT("/users/xuid/:xuid/gamertag", requireScope(ScopeUsersWrite), func(c *gin.Context) {
+		xuid := xuidParam(c)
+		var req UpdateGamertagRequest
+		bindJSON(c, &req)
+		user, err := s.service.UpdateGamertag(xuid, req.Gamertag)
+		utils.ErrorPanic(err)
+		c.JSON(http.StatusOK, SuccessPayload(user))
+	})
+
+	s.registerUserRoutes(r, SuccessPayload)
+}
+
+// registerUserRoutes adds the routes that are the same in the versioned and
+// the legacy API. payload wraps the response data the way the API expects.
+func (s *Server) registerUserRoutes(r gin.IRouter, payload func(data interface{}) Payload) {
+	r.GET("/users/discord/:id", requireScope(ScopeUsersRead), func(c *gin.Context) {
+		user, err := s.service.GetUserByDiscord(discordParam(c))
+		utils.ErrorPanic(err)
+		c.JSON(http.StatusOK, payload(user))
+	})
+
+	r.GET("/users/xuid/:xuid", requireScope(ScopeUsersRead), func(c *gin.Context) {
+		user, err := s.service.GetUserByXUID(xuidParam(c))
+		utils.ErrorPanic(err)
+		c.JSON(http.StatusOK, payload(user))
+	})
+
+	r.DELETE("/users/discord/:id", requireScope(ScopeUsersWrite), func(c *gin.Context) {
+		utils.ErrorPanic(s.service.DeleteUserByDiscord(discordParam(c)))
+		c.JSON(http.StatusOK, payload(nil))
+	})
+
+	r.DELETE("/users/xuid/:xuid", requireScope(ScopeUsersWrite), func(c *gin.Context) {
+		utils.ErrorPanic(s.service.DeleteUserByXUID(xuidParam(c)))
+		c.JSON(http.StatusOK, payload(nil))
+	})
+
+	r.GET("/users/discord/:id/history", requireScope(ScopeUsersRead), func(c *gin.Context) {
+		history, err := s.service.BindingHistoryByDiscord(discordParam(c))
+		utils.ErrorPanic(err)
+		c.JSON(http.StatusOK, payload(history))
+	})
+
+	r.GET("/users/xuid/:xuid/history", requireScope(ScopeUsersRead), func(c *gin.Context) {
+		history, err := s.service.BindingHistoryByXUID(xuidParam(c))
+		utils.ErrorPanic(err)
+		c.JSON(http.StatusOK, payload(history))
+	})
+}
+
+// guardCodeAttempt runs attempt unless the token is locked out and counts
+// wrong codes against the token.
+func (s *Server) guardCodeAttempt(c *gin.Context, code string, attempt func() error) {
+	name := c.MustGet(tokenContextKey).(*APIToken).Name
+	utils.ErrorPanic(s.codeAttempts.Check(name))
+	err := attempt()
+	if isWrongCode(err) {
+		failures, lockout := s.codeAttempts.Fail(name)
+		s.opts.Logger.Warn("Wrong code sent to the API",
+			"token", name,
+			"code", code,
+			"failures", failures,
+			"lockout", lockout.String(),
+		)
+	} else if err == nil {
+		s.codeAttempts.Succeed(name)
+	}
+	utils.ErrorPanic(err)
+}
+
+func discordParam(c *gin.Context) string {
+	discordId := c.Param("id")
+	if discordId == "" {
+		panic(NewApplicationError(ErrorCodeDiscordNotSpecified, "Discord ID is not specified"))
+	}
+	return discordId
+}
+
+func xuidParam(c *gin.Context) string {
+	xuid := c.Param("xuid")
+	if xuid == "" {
+		panic(NewApplicationError(ErrorCodeXUIDNotSpecified, "XUID is not specified"))
+	}
+	return xuid
+}
+
+// bindJSON decodes and validates the request body, panicking with an
+// ApplicationError naming the offending json fields.
+func bindJSON(c *gin.Context, req interface{}) {
+	err := c.ShouldBindJSON(req)
+	if err == nil {
+		return
+	}
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		panic(NewApplicationErrorf(ErrorCodeInvalidRequest, "Invalid request: %s", err.Error()))
+	}
+	reqType := reflect.TypeOf(req).Elem()
+	problems := make([]string, 0, len(validationErrors))
+	for _, fieldErr := range validationErrors {
+		name := fieldErr.Field()
+		if field, ok := reqType.FieldByName(fieldErr.StructField()); ok {
+			name, _, _ = strings.Cut(field.Tag.Get("json"), ",")
+		}
+		problems = append(problems, fmt.Sprintf("%s: %s", name, fieldErr.Tag()))
+	}
+	panic(NewApplicationErrorf(ErrorCodeInvalidRequest, "Invalid request: %s", strings.Join(problems, ", ")))
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// attemptLimiter locks a key out once it failed limit times in a row. The
+// lockout doubles with every further failure. A nil limiter allows everything.
+type attemptLimiter struct {
+	limit      int
+	lockout    time.Duration
+	maxLockout time.Duration
+
+	mu       sync.Mutex
+	attempts map[string]*attempts
+}
+
+type attempts struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// newAttemptLimiter returns nil when limit isn't positive.
+func newAttemptLimiter(limit int, lockout, maxLockout time.Duration) *attemptLimiter {
+	if limit <= 0 {
+		return nil
+	}
+	l := &attemptLimiter{
+		limit:      limit,
+		lockout:    lockout,
+		maxLockout: maxLockout,
+		attempts:   make(map[string]*attempts),
+	}
+	go l.sweep(time.Minute)
+	return l
+}
+
+// Check returns an ApplicationError while the key is locked out.
+func (l *attemptLimiter) Check(key string) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	a := l.attempts[key]
+	if a == nil {
+		return nil
+	}
+	if remaining := time.Until(a.lockedUntil); remaining > 0 {
+		return NewApplicationErrorf(ErrorCodeTooManyAttempts, "Too many failed attempts, try again in %s", remaining.Round(time.Second))
+	}
+	return nil
+}
+
+// Fail records a failed attempt and returns the failures in a row and the
+// resulting lockout, if any.
+func (l *attemptLimiter) Fail(key string) (int, time.Duration) {
+	if l == nil {
+		return 0, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	a := l.attempts[key]
+	if a == nil {
+		a = &attempts{}
+		l.attempts[key] = a
+	}
+	now := time.Now()
+	a.failures++
+	a.lastFailure = now
+	if a.failures < l.limit {
+		return a.failures, 0
+	}
+	// Doubling step by step stops at maxLockout instead of overflowing.
+	lockout := min(l.lockout, l.maxLockout)
+	for i := l.limit; i < a.failures && lockout < l.maxLockout; i++ {
+		if lockout > l.maxLockout/2 {
+			lockout = l.maxLockout
+		} else {
+			lockout *= 2
+		}
+	}
+	a.lockedUntil = now.Add(lockout)
+	return a.failures, lockout
+}
+
+// Succeed forgets the failures of the key.
+func (l *attemptLimiter) Succeed(key string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.attempts, key)
+}
+
+// sweep periodically forgets idle keys.
+func (l *attemptLimiter) sweep(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		l.forgetIdle(now)
+	}
+}
+
+// forgetIdle forgets keys that have been idle for longer than the longest
+// lockout, counting from the end of their last lockout. Counting from the last
+// failure would reset a key that merely waited out a long lockout.
+func (l *attemptLimiter) forgetIdle(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for key, a := range l.attempts {
+		idleSince := a.lastFailure
+		if a.lockedUntil.After(idleSince) {
+			idleSince = a.lockedUntil
+		}
+		if now.Sub(idleSince) > l.maxLockout {
+			delete(l.attempts, key)
+		}
+	}
+}
+
+// isWrongCode reports whether err means the code doesn't exist, which is
+// what guessing codes mostly runs into.
+func isWrongCode(err error) bool {
+	var appError ApplicationError
+	return errors.As(err, &appError) && appError.ErrorCode == ErrorCodeCodeNotFound
+}
@@ -0,0 +1,42 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAttemptLimiterLockoutDoubles(t *testing.T) {
+	l := newAttemptLimiter(3, time.Minute, time.Hour)
+	want := []time.Duration{0, 0, time.Minute, 2 * time.Minute, 4 * time.Minute}
+	for i, expected := range want {
+		if _, lockout := l.Fail("key"); lockout != expected {
+			t.Fatalf("failure %d: lockout %s, want %s", i+1, lockout, expected)
+		}
+	}
+	// Far more failures than fit into a shift must stay at the maximum.
+	for i := 0; i < 100; i++ {
+		if _, lockout := l.Fail("key"); lockout <= 0 || lockout > time.Hour {
+			t.Fatalf("failure %d: lockout %s, want at most 1h", len(want)+i+1, lockout)
+		}
+	}
+	if _, lockout := l.Fail("key"); lockout != time.Hour {
+		t.Fatalf("lockout %s, want 1h", lockout)
+	}
+}
+
+func TestAttemptLimiterKeepsKeysDuringLockout(t *testing.T) {
+	l := newAttemptLimiter(1, time.Hour, time.Hour)
+	l.Fail("key")
+	lockedUntil := l.attempts["key"].lockedUntil
+
+	// Longer than maxLockout since the failure, but only just after the
+	// lockout ended.
+	l.forgetIdle(lockedUntil.Add(time.Minute))
+	if l.attempts["key"] == nil {
+		t.Fatal("key forgotten right after its lockout ended")
+	}
+	l.forgetIdle(lockedUntil.Add(time.Hour + time.Minute))
+	if l.attempts["key"] != nil {
+		t.Fatal("key kept after being idle for longer than the longest lockout")
+	}
+}
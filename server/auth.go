@@ -0,0 +1,123 @@
+package server
+
+import (
+	"crypto/subtle"
+	"errors"
+	"github.com/Gewinum/go-df-discord/utils"
+	"github.com/gin-gonic/gin"
+	sloggin "github.com/samber/slog-gin"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// tokenContextKey is where authMiddleware stores the *APIToken of the request.
+const tokenContextKey = "dfdiscord.token"
+
+type CreateTokenRequest struct {
+	Name   string   `json:"name" binding:"required"`
+	Scopes []string `json:"scopes" binding:"required"`
+}
+
+// CreatedToken holds the secret of a new token, which is not stored and can't
+// be shown again.
+type CreatedToken struct {
+	Secret string    `json:"secret"`
+	Token  *APIToken `json:"token"`
+}
+
+// CreateToken adds a named API token with the given scopes and returns its
+// secret.
+func (s *Server) CreateToken(name string, scopes []string) (*CreatedToken, error) {
+	if name == rootTokenName {
+		return nil, NewApplicationErrorf(ErrorCodeTokenAlreadyExists, "Token %s already exists", name)
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(AllScopes, scope) {
+			return nil, NewApplicationErrorf(ErrorCodeUnknownScope, "Unknown scope %s", scope)
+		}
+	}
+	secret, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+	token := &APIToken{Name: name, Scopes: scopes, Created: time.Now()}
+	err = s.opts.TokenStr.Create(token, hashToken(secret))
+	if err != nil {
+		return nil, err
+	}
+	return &CreatedToken{Secret: secret, Token: token}, nil
+}
+
+func (s *Server) Tokens() ([]*APIToken, error) {
+	return s.opts.TokenStr.List()
+}
+
+func (s *Server) DeleteToken(name string) error {
+	return s.opts.TokenStr.Delete(name)
+}
+
+func (s *Server) registerTokens(r gin.IRouter) {
+	r.GET("", func(c *gin.Context) {
+		tokens, err := s.Tokens()
+		utils.ErrorPanic(err)
+		c.JSON(http.StatusOK, SuccessPayload(tokens))
+	})
+
+	r.POST("", func(c *gin.Context) {
+		var req CreateTokenRequest
+		bindJSON(c, &req)
+		created, err := s.CreateToken(req.Name, req.Scopes)
+		utils.ErrorPanic(err)
+		c.JSON(http.StatusOK, SuccessPayload(created))
+	})
+
+	r.DELETE("/:name", func(c *gin.Context) {
+		utils.ErrorPanic(s.DeleteToken(c.Param("name")))
+		c.JSON(http.StatusOK, SuccessPayload(nil))
+	})
+}
+
+// authMiddleware accepts the root token and named tokens, either as Bearer
+// token or as the bare Authorization header older clients send.
+func (s *Server) authMiddleware(c *gin.Context) {
+	token, err := s.authenticate(c.GetHeader("Authorization"))
+	if err != nil {
+		var appError ApplicationError
+		if !errors.As(err, &appError) {
+			s.opts.Logger.Error("Could not look up API token", "error", err)
+		}
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	c.Set(tokenContextKey, token)
+	sloggin.AddCustomAttributes(c, slog.String("token", token.Name))
+	c.Next()
+}
+
+// authenticate only ever compares hashes of the secret, so the time taken
+// reveals nothing about the stored secrets.
+func (s *Server) authenticate(header string) (*APIToken, error) {
+	secret := strings.TrimPrefix(header, "Bearer ")
+	if secret == "" {
+		return nil, NewApplicationError(ErrorCodeTokenNotFound, "Token not found")
+	}
+	hash := hashToken(secret)
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(s.accessTokenHash)) == 1 {
+		return &APIToken{Name: rootTokenName, Scopes: AllScopes}, nil
+	}
+	return s.opts.TokenStr.GetByHash(hash)
+}
+
+// requireScope rejects requests whose token lacks the scope.
+func requireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.MustGet(tokenContextKey).(*APIToken)
+		if !token.HasScope(scope) {
+			panic(NewApplicationErrorf(ErrorCodeMissingScope, "Token lacks the %s scope", scope))
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// serveWithAuthorization sends a request with the given Authorization header.
+func serveWithAuthorization(handler http.Handler, method, path, authorization, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// createTestToken creates a token through the API and returns its secret.
+func createTestToken(t *testing.T, handler http.Handler, name string, scopes ...string) string {
+	t.Helper()
+	body, err := json.Marshal(CreateTokenRequest{Name: name, Scopes: scopes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := serveTest(t, handler, http.MethodPost, "/v1/tokens", string(body))
+	secret, _ := created["secret"].(string)
+	if secret == "" {
+		t.Fatalf("created token = %v, want a secret", created)
+	}
+	return secret
+}
+
+func TestAuthAcceptsBearerAndBareTokens(t *testing.T) {
+	_, handler := newTestServer(t)
+	secret := createTestToken(t, handler, "reader", ScopeUsersRead)
+	for _, authorization := range []string{
+		"Bearer " + testAccessToken,
+		testAccessToken,
+		"Bearer " + secret,
+		secret,
+	} {
+		rec := serveWithAuthorization(handler, http.MethodGet, "/v1/users/xuid/1000", authorization, "")
+		// The user doesn't exist, but the token got past authentication.
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("Authorization %q: status %d, want %d", authorization, rec.Code, http.StatusNotFound)
+		}
+	}
+}
+
+func TestAuthRejectsUnknownAndDeletedTokens(t *testing.T) {
+	_, handler := newTestServer(t)
+	secret := createTestToken(t, handler, "reader", ScopeUsersRead)
+	serveTest(t, handler, http.MethodDelete, "/v1/tokens/reader", "")
+	for _, authorization := range []string{"", "Bearer ", "Bearer unknown", "Bearer " + secret, secret} {
+		rec := serveWithAuthorization(handler, http.MethodGet, "/v1/users/xuid/1000", authorization, "")
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("Authorization %q: status %d, want %d", authorization, rec.Code, http.StatusUnauthorized)
+		}
+	}
+}
+
+func TestAuthRequiresScope(t *testing.T) {
+	_, handler := newTestServer(t)
+	secret := createTestToken(t, handler, "reader", ScopeUsersRead)
+	for _, request := range []struct{ method, path, body string }{
+		{http.MethodPost, "/v1/codes/issue", `{"xuid":"1000"}`},
+		{http.MethodGet, "/v1/tokens", ""},
+		{http.MethodPost, "/codes/issue", "1000"},
+	} {
+		rec := serveWithAuthorization(handler, request.method, request.path, "Bearer "+secret, request.body)
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("%s %s: status %d, want %d", request.method, request.path, rec.Code, http.StatusForbidden)
+		}
+	}
+}
+
+func TestCreateTokenStoresOnlyHash(t *testing.T) {
+	s, handler := newTestServer(t)
+	secret := createTestToken(t, handler, "reader", ScopeUsersRead)
+
+	var stored []TokenData
+	if err := s.opts.Repo.(*defaultRepository).db.Find(&stored).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 1 || stored[0].Name != "reader" || stored[0].Hash != hashToken(secret) {
+		t.Fatalf("stored tokens = %+v, want reader with the hash of the secret", stored)
+	}
+	if stored[0].Scopes != ScopeUsersRead {
+		t.Fatalf("stored scopes = %q, want %q", stored[0].Scopes, ScopeUsersRead)
+	}
+
+	// The secret is shown once, listing tokens doesn't reveal it again.
+	rec := serveWithAuthorization(handler, http.MethodGet, "/v1/tokens", "Bearer "+testAccessToken, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /v1/tokens: status %d", rec.Code)
+	}
+	if strings.Contains(rec.Body.String(), secret) || strings.Contains(rec.Body.String(), stored[0].Hash) {
+		t.Fatalf("token list %s reveals the secret or its hash", rec.Body)
+	}
+}
+
+func TestCreateTokenRejectsInvalidRequests(t *testing.T) {
+	_, handler := newTestServer(t)
+	for _, body := range []string{
+		`{"name":"root","scopes":["users:read"]}`,
+		`{"name":"reader","scopes":["users:delete"]}`,
+	} {
+		rec := serveWithAuthorization(handler, http.MethodPost, "/v1/tokens", "Bearer "+testAccessToken, body)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("creating %s: status %d, want %d", body, rec.Code, http.StatusBadRequest)
+		}
+	}
+	rec := serveWithAuthorization(handler, http.MethodGet, "/v1/tokens", "Bearer "+testAccessToken, "")
+	var payload struct {
+		Data []*APIToken `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &payload); err != nil {
+		t.Fatal(err)
+	}
+	if len(payload.Data) != 0 {
+		t.Fatalf("tokens = %+v after invalid requests, want none", payload.Data)
+	}
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"github.com/bwmarrin/discordgo"
+	"strings"
+	"time"
+)
+
+// pendingBind is a /bind waiting for the member to confirm the account the
+// code belongs to.
+type pendingBind struct {
+	code        string
+	interaction *discordgo.Interaction
+	timer       *time.Timer
+}
+
+// bind shows which minecraft account the code belongs to. The binding is only
+// created once the member confirms it through bindButton.
+func (b *Bot) bind(i *discordgo.InteractionCreate, options map[string]*discordgo.ApplicationCommandInteractionDataOption) *discordgo.InteractionResponseData {
+	lang := interactionLanguage(i)
+	discordId := invokingUser(i).ID
+	err := b.bindAttempts.Check(discordId)
+	if err != nil {
+		return errorResponse(lang, err)
+	}
+	code := options["code"].StringValue()
+	info, err := b.service.CheckCode(code)
+	if err != nil {
+		if isWrongCode(err) {
+			failures, lockout := b.bindAttempts.Fail(discordId)
+			b.opts.Logger.Warn("Wrong code entered in /bind",
+				"discord", discordId,
+				"code", code,
+				"failures", failures,
+				"lockout", lockout.String(),
+			)
+		}
+		return errorResponse(lang, err)
+	}
+	b.bindAttempts.Succeed(discordId)
+	b.addPendingBind(discordId, info.Code, i.Interaction)
+
+	target := &User{Discord: discordId, XUID: info.XUID, Gamertag: info.Gamertag}
+	response := userEmbedResponse(lang, tr(lang, "bind_confirm"), colorInfo, target)
+	response.Components = []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.Button{
+					Label:    tr(lang, "button_confirm"),
+					Style:    discordgo.SuccessButton,
+					CustomID: "bind:confirm:" + info.Code,
+				},
+				discordgo.Button{
+					Label:    tr(lang, "button_cancel"),
+					Style:    discordgo.SecondaryButton,
+					CustomID: "bind:cancel:" + info.Code,
+				},
+			},
+		},
+	}
+	return response
+}
+
+// bindButton handles the buttons of a /bind confirmation. Their custom IDs
+// carry the code, so buttons of a confirmation replaced by a later /bind
+// can't act on the newer one.
+func (b *Bot) bindButton(i *discordgo.InteractionCreate, data discordgo.MessageComponentInteractionData) *discordgo.InteractionResponse {
+	lang := interactionLanguage(i)
+	discordId := invokingUser(i).ID
+	action, code, _ := strings.Cut(strings.TrimPrefix(data.CustomID, "bind:"), ":")
+	pending := b.takePendingBind(discordId, code)
+	if pending == nil {
+		return updateResponse(messageResponse(tr(lang, "bind_expired")))
+	}
+	if action != "confirm" {
+		return updateResponse(messageResponse(tr(lang, "bind_cancelled")))
+	}
+	user, err := b.service.Bind(pending.code, discordId)
+	if err != nil {
+		return updateResponse(errorResponse(lang, err))
+	}
+	return updateResponse(userEmbedResponse(lang, tr(lang, "bind_created"), colorSuccess, user))
+}
+
+// addPendingBind replaces any earlier confirmation of the member and arranges
+// for the new one to time out after Opts.BindConfirmTimeout. The replaced
+// confirmation loses its buttons.
+func (b *Bot) addPendingBind(discordId, code string, interaction *discordgo.Interaction) {
+	b.pendingMu.Lock()
+	defer b.pendingMu.Unlock()
+	if previous := b.pendingBinds[discordId]; previous != nil {
+		previous.timer.Stop()
+		go b.closePendingBind(discordId, previous)
+	}
+	pending := &pendingBind{code: code, interaction: interaction}
+	b.pendingBinds[discordId] = pending
+	pending.timer = time.AfterFunc(b.opts.BindConfirmTimeout, func() {
+		b.expirePendingBind(discordId, pending)
+	})
+}
+
+func (b *Bot) expirePendingBind(discordId string, pending *pendingBind) {
+	b.pendingMu.Lock()
+	current := b.pendingBinds[discordId]
+	if current == pending {
+		delete(b.pendingBinds, discordId)
+	}
+	b.pendingMu.Unlock()
+	if current != pending {
+		return
+	}
+	b.closePendingBind(discordId, pending)
+}
+
+// closePendingBind replaces the confirmation message with the expiry notice.
+func (b *Bot) closePendingBind(discordId string, pending *pendingBind) {
+	content := tr(localeLanguage(pending.interaction.Locale), "bind_expired")
+	_, err := b.api.InteractionResponseEdit(pending.interaction, &discordgo.WebhookEdit{
+		Content:    &content,
+		Embeds:     &[]*discordgo.MessageEmbed{},
+		Components: &[]discordgo.MessageComponent{},
+	})
+	if err != nil {
+		b.opts.Logger.Debug("Could not expire binding confirmation", "discord", discordId, "error", err)
+	}
+}
+
+// takePendingBind removes and returns the member's confirmation if it is
+// for the given code.
+func (b *Bot) takePendingBind(discordId, code string) *pendingBind {
+	b.pendingMu.Lock()
+	defer b.pendingMu.Unlock()
+	pending := b.pendingBinds[discordId]
+	if pending == nil || pending.code != code {
+		return nil
+	}
+	delete(b.pendingBinds, discordId)
+	pending.timer.Stop()
+	return pending
+}
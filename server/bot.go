@@ -1,19 +1,36 @@
 package server
 
 import (
-	"errors"
+	"github.com/Gewinum/go-df-discord/utils"
 	"github.com/bwmarrin/discordgo"
+	"sync"
 )
 
 type Bot struct {
 	api     *discordgo.Session
 	service *Service
+	opts    *Opts
 	cmds    []*discordgo.ApplicationCommand
+	// guildId is where cmds were registered, empty for global commands.
+	guildId string
+
+	mu                   sync.RWMutex
+	commands             []*discordgo.ApplicationCommand
+	commandHandlers      map[string]CustomCommandHandler
+	autocompleteHandlers map[string]AutocompleteHandler
+	componentHandlers    map[string]ComponentHandler
+	modalHandlers        map[string]ModalHandler
+
+	pendingMu    sync.Mutex
+	pendingBinds map[string]*pendingBind
+
+	// bindAttempts limits wrong codes per discord member.
+	bindAttempts *attemptLimiter
 }
 
-type CustomCommandHandler func(i *discordgo.InteractionCreate, options map[string]*discordgo.ApplicationCommandInteractionDataOption) string
+type CustomCommandHandler func(i *discordgo.InteractionCreate, options map[string]*discordgo.ApplicationCommandInteractionDataOption) *discordgo.InteractionResponseData
 
-func NewBot(discordToken string, service *Service) (*Bot, error) {
+func NewBot(discordToken string, service *Service, opts *Opts) (*Bot, error) {
 	api, err := discordgo.New("Bot " + discordToken)
 	if err != nil {
 		return nil, err
@@ -22,89 +39,181 @@ func NewBot(discordToken string, service *Service) (*Bot, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Bot{api: api, service: service}, nil
+	b := &Bot{
+		api:                  api,
+		service:              service,
+		opts:                 opts,
+		commandHandlers:      make(map[string]CustomCommandHandler),
+		autocompleteHandlers: make(map[string]AutocompleteHandler),
+		componentHandlers:    make(map[string]ComponentHandler),
+		modalHandlers:        make(map[string]ModalHandler),
+		pendingBinds:         make(map[string]*pendingBind),
+		bindAttempts:         newAttemptLimiter(opts.BindAttempts, opts.AttemptLockout, opts.MaxAttemptLockout),
+	}
+	b.addDefaultCommands()
+	api.AddHandler(b.handleInteraction)
+	if opts.GuildID != "" && len(opts.BindRoles) > 0 {
+		On(service, func(event BindingCreated) {
+			go b.grantRoles(event.User.Discord)
+		})
+		On(service, func(event BindingRemoved) {
+			go b.revokeRoles(event.User.Discord)
+		})
+	}
+	if opts.GuildID != "" && opts.NicknameTemplate != "" {
+		On(service, func(event BindingCreated) {
+			go b.syncNickname(event.User)
+		})
+		On(service, func(event GamertagChanged) {
+			go b.syncNickname(event.User)
+		})
+		On(service, func(event BindingRemoved) {
+			go b.resetNickname(event.User.Discord)
+		})
+	}
+	return b, nil
 }
 
+var (
+	// anyContext allows a command in guilds, DMs with the bot and, when the
+	// bot is user-installed, in any other DM or group DM.
+	anyContext = &[]discordgo.InteractionContextType{
+		discordgo.InteractionContextGuild,
+		discordgo.InteractionContextBotDM,
+		discordgo.InteractionContextPrivateChannel,
+	}
+	guildContext = &[]discordgo.InteractionContextType{
+		discordgo.InteractionContextGuild,
+	}
+	anyInstall = &[]discordgo.ApplicationIntegrationType{
+		discordgo.ApplicationIntegrationGuildInstall,
+		discordgo.ApplicationIntegrationUserInstall,
+	}
+	guildInstall = &[]discordgo.ApplicationIntegrationType{
+		discordgo.ApplicationIntegrationGuildInstall,
+	}
+)
+
+// RegisterCommands registers every added command in the guild, or globally
+// when guildId is empty.
+//
+// Deprecated: use SyncCommands, which returns errors instead of panicking.
 func (b *Bot) RegisterCommands(guildId string) {
-	b.cmds = make([]*discordgo.ApplicationCommand, 0)
-	cmds := []*discordgo.ApplicationCommand{
-		{
-			Name:        "bind",
-			Description: "Bind your minecraft to your discord account",
-			Options: []*discordgo.ApplicationCommandOption{
-				{
-					Type:        discordgo.ApplicationCommandOptionString,
-					Name:        "code",
-					Description: "in-game minecraft account code",
-					Required:    true,
-				},
+	utils.ErrorPanic(b.SyncCommands(guildId))
+}
+
+func (b *Bot) addDefaultCommands() {
+	b.AddCommand(&discordgo.ApplicationCommand{
+		Name:             "bind",
+		Description:      "Bind your minecraft to your discord account",
+		Contexts:         anyContext,
+		IntegrationTypes: anyInstall,
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "code",
+				Description: "in-game minecraft account code",
+				Required:    true,
 			},
 		},
-		{
-			Name:        "unbind",
-			Description: "Unbind your minecraft account from your discord account",
-		},
+	}, b.bind)
+	b.AddComponentHandler("bind", b.bindButton)
+
+	b.AddCommand(&discordgo.ApplicationCommand{
+		Name:             "unbind",
+		Description:      "Unbind your minecraft account from your discord account",
+		Contexts:         anyContext,
+		IntegrationTypes: anyInstall,
+	}, b.unbind)
+	b.AddComponentHandler("unbind", b.unbindButton)
+
+	// Without a staff role /whois is limited to moderators by discord, guild
+	// admins can still widen it in the integration settings.
+	var whoisPermissions *int64
+	if b.opts.StaffRole == "" {
+		moderateMembers := int64(discordgo.PermissionModerateMembers)
+		whoisPermissions = &moderateMembers
 	}
-	handlers := map[string]CustomCommandHandler{
-		"bind": func(i *discordgo.InteractionCreate, options map[string]*discordgo.ApplicationCommandInteractionDataOption) string {
-			codeInfo, err := b.service.CheckCode(options["code"].StringValue())
-			if err != nil {
-				if errors.As(err, &ApplicationError{}) {
-					return err.Error()
-				} else {
-					return "Something went wrong"
-				}
-			}
-			discordId := i.Member.User.ID
-			_, err = b.service.CreateUser(discordId, codeInfo.XUID)
-			if err != nil {
-				if errors.As(err, &ApplicationError{}) {
-					return err.Error()
-				} else {
-					return "Something went wrong"
-				}
-			}
-			_ = b.service.RevokeCode(codeInfo.Code)
-			return "Binding has been created successfully"
+	b.AddCommand(&discordgo.ApplicationCommand{
+		Name:                     "whois",
+		Description:              "Look up the binding of a discord member or minecraft player",
+		DefaultMemberPermissions: whoisPermissions,
+		Contexts:                 guildContext,
+		IntegrationTypes:         guildInstall,
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionUser,
+				Name:        "user",
+				Description: "discord member to look up",
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "gamertag",
+				Description: "minecraft gamertag to look up",
+			},
 		},
-		"unbind": func(i *discordgo.InteractionCreate, options map[string]*discordgo.ApplicationCommandInteractionDataOption) string {
-			discordId := i.Member.User.ID
-			err := b.service.DeleteUserByDiscord(discordId)
-			if err != nil {
-				if errors.As(err, &ApplicationError{}) {
-					return err.Error()
-				} else {
-					return "Something went wrong"
+	}, b.whois)
+
+	b.AddCommand(&discordgo.ApplicationCommand{
+		Name:             "profile",
+		Description:      "Show the minecraft account bound to your discord account",
+		Contexts:         anyContext,
+		IntegrationTypes: anyInstall,
+	}, b.profile)
+
+	if b.opts.GuildID != "" && len(b.opts.BindRoles) > 0 {
+		manageRoles := int64(discordgo.PermissionManageRoles)
+		b.AddCommand(&discordgo.ApplicationCommand{
+			Name:                     "reconcile-roles",
+			Description:              "Re-apply binding roles to every bound member",
+			DefaultMemberPermissions: &manageRoles,
+			Contexts:                 guildContext,
+			IntegrationTypes:         guildInstall,
+		}, func(i *discordgo.InteractionCreate, options map[string]*discordgo.ApplicationCommandInteractionDataOption) *discordgo.InteractionResponseData {
+			go func() {
+				err := b.ReconcileRoles()
+				if err != nil {
+					b.opts.Logger.Error("Role reconciliation failed", "error", err)
 				}
-			}
-			return "Binding has been removed successfully"
-		},
+			}()
+			return messageResponse(tr(interactionLanguage(i), "reconcile_started"))
+		})
 	}
 
-	for _, cmd := range cmds {
-		registeredCmd, err := b.api.ApplicationCommandCreate(b.api.State.User.ID, guildId, cmd)
-		if err != nil {
-			panic(err)
-		}
-		b.cmds = append(b.cmds, registeredCmd)
+	b.addAdminCommands()
+
+	b.mu.Lock()
+	for _, cmd := range b.commands {
+		localizeCommand(cmd)
 	}
+	b.mu.Unlock()
+}
 
-	b.api.AddHandler(func(s *discordgo.Session, i *discordgo.InteractionCreate) {
-		if h, ok := handlers[i.ApplicationCommandData().Name]; ok {
-			options := i.ApplicationCommandData().Options
-
-			optionMap := make(map[string]*discordgo.ApplicationCommandInteractionDataOption, len(options))
-			for _, opt := range options {
-				optionMap[opt.Name] = opt
-			}
-
-			response := h(i, optionMap)
-			_ = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-				Type: discordgo.InteractionResponseChannelMessageWithSource,
-				Data: &discordgo.InteractionResponseData{
-					Content: response,
-				},
-			})
-		}
+// recoverHandler keeps a panicking interaction handler from crashing the discordgo
+// event goroutine and answers the interaction with a generic error instead.
+func (b *Bot) recoverHandler(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	rawErr := recover()
+	if rawErr == nil {
+		return
+	}
+	b.opts.Logger.Error("Interaction handler panicked",
+		"type", i.Type.String(),
+		"panic", rawErr,
+	)
+	if i.Type == discordgo.InteractionApplicationCommandAutocomplete {
+		return
+	}
+	_ = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: messageResponse(tr(interactionLanguage(i), "something_went_wrong")),
 	})
 }
+
+// invokingUser returns the user that ran the interaction. Member is only set
+// for interactions in guilds, User only for the ones in DMs.
+func invokingUser(i *discordgo.InteractionCreate) *discordgo.User {
+	if i.Member != nil {
+		return i.Member.User
+	}
+	return i.User
+}
@@ -2,88 +2,185 @@ package server
 
 import (
 	"crypto/rand"
-	"fmt"
+	"slices"
+	"sync"
 	"time"
 )
 
 type CodeInformation struct {
-	Code    string
-	XUID    string
-	Issued  string
-	Expires string
+	Code     string    `json:"code"`
+	XUID     string    `json:"xuid"`
+	Gamertag string    `json:"gamertag"`
+	Issued   time.Time `json:"issued"`
+	Expires  time.Time `json:"expires"`
 }
 
+// Expired reports whether the code is no longer valid at the given time.
+func (i *CodeInformation) Expired(now time.Time) bool {
+	return !now.Before(i.Expires)
+}
+
+// defaultCodeTTL is used when a store is created without a positive TTL.
+const defaultCodeTTL = 15 * time.Minute
+
+// CodeStore keeps the outstanding codes. Every store reports unknown and
+// expired codes alike, as an ErrorCodeCodeNotFound ApplicationError, so the
+// HTTP status and the counting of wrong codes don't depend on the store.
 type CodeStore interface {
 	GetInformation(code string) (*CodeInformation, error)
 	GetForXuid(xuid string) (*CodeInformation, error)
-	Issue(xuid string) (*CodeInformation, error)
+	Issue(xuid, gamertag string) (*CodeInformation, error)
 	Revoke(code string) error
+	// List returns every code that has not expired yet, oldest first.
+	List() ([]*CodeInformation, error)
+}
+
+// ExpiringCodeStore is implemented by stores that can report codes they drop
+// after expiry, so Service can publish CodeExpired.
+type ExpiringCodeStore interface {
+	CodeStore
+	SetExpiryHandler(handler func(info *CodeInformation))
 }
 
 type defaultCodeStore struct {
-	codes map[string]*CodeInformation
+	mu       sync.Mutex
+	ttl      time.Duration
+	codes    map[string]*CodeInformation
+	onExpire func(info *CodeInformation)
 }
 
-func newDefaultCodeStore() CodeStore {
-	return &defaultCodeStore{
+func newDefaultCodeStore(ttl time.Duration) CodeStore {
+	if ttl <= 0 {
+		ttl = defaultCodeTTL
+	}
+	s := &defaultCodeStore{
+		ttl:   ttl,
 		codes: make(map[string]*CodeInformation),
 	}
+	go s.sweep(min(ttl, time.Minute))
+	return s
+}
+
+func (s *defaultCodeStore) SetExpiryHandler(handler func(info *CodeInformation)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onExpire = handler
 }
 
 func (s *defaultCodeStore) GetInformation(code string) (*CodeInformation, error) {
-	info, exists := s.codes[code]
-	if !exists {
-		return nil, NewApplicationError(40400, "Code doesn't exist")
-	}
-	return info, nil
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.getInformation(code)
 }
 
 func (s *defaultCodeStore) GetForXuid(xuid string) (*CodeInformation, error) {
-	for _, info := range s.codes {
-		if info.XUID == xuid {
-			return info, nil
-		}
-	}
-	return nil, NewApplicationError(40400, "There is no code for this XUID")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.getForXuid(xuid)
 }
 
-func (s *defaultCodeStore) Issue(xuid string) (*CodeInformation, error) {
-	existing, _ := s.GetForXuid(xuid)
+func (s *defaultCodeStore) Issue(xuid, gamertag string) (*CodeInformation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	existing, _ := s.getForXuid(xuid)
 	if existing != nil {
-		return nil, NewApplicationError(40000, fmt.Sprintf("Code %s is already issued", existing.Code))
+		return nil, NewApplicationErrorf(ErrorCodeCodeAlreadyIssued, "Code %s is already issued", existing.Code)
 	}
 	generatedCode := s.findFreeCode()
+	now := time.Now()
 	s.codes[generatedCode] = &CodeInformation{
-		Code:    generatedCode,
-		XUID:    xuid,
-		Issued:  time.Now().Format(time.Kitchen),
-		Expires: time.Now().Add(15 * time.Minute).Format(time.Kitchen),
+		Code:     generatedCode,
+		XUID:     xuid,
+		Gamertag: gamertag,
+		Issued:   now,
+		Expires:  now.Add(s.ttl),
 	}
 	return s.codes[generatedCode], nil
 }
 
 func (s *defaultCodeStore) Revoke(code string) error {
-	info, _ := s.GetInformation(code)
-	if info == nil {
-		return NewApplicationError(40400, "Code doesn't exist")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.codes[code]; !exists {
+		return NewApplicationError(ErrorCodeCodeNotFound, "Code doesn't exist")
 	}
 	delete(s.codes, code)
 	return nil
 }
 
+func (s *defaultCodeStore) List() ([]*CodeInformation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	codes := make([]*CodeInformation, 0, len(s.codes))
+	for _, info := range s.codes {
+		if !info.Expired(now) {
+			codes = append(codes, info)
+		}
+	}
+	slices.SortFunc(codes, compareIssued)
+	return codes, nil
+}
+
+func (s *defaultCodeStore) getInformation(code string) (*CodeInformation, error) {
+	info, exists := s.codes[code]
+	// Expired codes are left for sweep, which reports them to onExpire.
+	if !exists || info.Expired(time.Now()) {
+		return nil, NewApplicationError(ErrorCodeCodeNotFound, "Code doesn't exist")
+	}
+	return info, nil
+}
+
+func (s *defaultCodeStore) getForXuid(xuid string) (*CodeInformation, error) {
+	now := time.Now()
+	for _, info := range s.codes {
+		if info.XUID == xuid && !info.Expired(now) {
+			return info, nil
+		}
+	}
+	return nil, NewApplicationError(ErrorCodeNoCodeForXUID, "There is no code for this XUID")
+}
+
+// sweep periodically removes expired codes so they don't pile up in memory.
+func (s *defaultCodeStore) sweep(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		var expired []*CodeInformation
+		s.mu.Lock()
+		for code, info := range s.codes {
+			if info.Expired(now) {
+				delete(s.codes, code)
+				expired = append(expired, info)
+			}
+		}
+		onExpire := s.onExpire
+		s.mu.Unlock()
+		if onExpire == nil {
+			continue
+		}
+		for _, info := range expired {
+			onExpire(info)
+		}
+	}
+}
+
 func (s *defaultCodeStore) findFreeCode() string {
 	for {
 		generated, err := generateCode(6)
 		if err != nil {
 			panic(err)
 		}
-		info, _ := s.GetInformation(generated)
-		if info == nil {
+		if _, exists := s.codes[generated]; !exists {
 			return generated
 		}
 	}
 }
 
+func compareIssued(a, b *CodeInformation) int {
+	return a.Issued.Compare(b.Issued)
+}
+
 func generateCode(length int) (string, error) {
 	randomChars := "0123456789ABCDEFGHIKLMNOPQRSTVXYZ"
 	buffer := make([]byte, length)
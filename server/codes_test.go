@@ -0,0 +1,45 @@
+package server
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDefaultCodeStoreExpiry(t *testing.T) {
+	store := newDefaultCodeStore(50 * time.Millisecond)
+	var mu sync.Mutex
+	reported := map[string]int{}
+	store.(ExpiringCodeStore).SetExpiryHandler(func(info *CodeInformation) {
+		mu.Lock()
+		defer mu.Unlock()
+		reported[info.Code]++
+	})
+	first, err := store.Issue("1000", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(60 * time.Millisecond)
+
+	if _, err := store.GetInformation(first.Code); errorCode(err) != ErrorCodeCodeNotFound {
+		t.Fatalf("GetInformation after expiry: %v", err)
+	}
+	if _, err := store.GetForXuid("1000"); errorCode(err) != ErrorCodeNoCodeForXUID {
+		t.Fatalf("GetForXuid after expiry: %v", err)
+	}
+	second, err := store.Issue("1000", "")
+	if err != nil {
+		t.Fatalf("Issue after expiry: %v", err)
+	}
+	if second.Code == first.Code {
+		t.Fatal("Issue after expiry returned the expired code")
+	}
+
+	// Give the sweep a few more ticks to report the first code twice.
+	time.Sleep(150 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if reported[first.Code] != 1 {
+		t.Fatalf("expired code reported %d times, want 1", reported[first.Code])
+	}
+}
@@ -0,0 +1,169 @@
+package server
+
+import (
+	"github.com/bwmarrin/discordgo"
+	"strings"
+)
+
+// AutocompleteHandler returns the choices for the focused option.
+type AutocompleteHandler func(i *discordgo.InteractionCreate, focused *discordgo.ApplicationCommandInteractionDataOption, options map[string]*discordgo.ApplicationCommandInteractionDataOption) []*discordgo.ApplicationCommandOptionChoice
+
+// ComponentHandler handles button and select menu interactions. Returning nil
+// leaves the interaction unanswered.
+type ComponentHandler func(i *discordgo.InteractionCreate, data discordgo.MessageComponentInteractionData) *discordgo.InteractionResponse
+
+// ModalHandler handles modal submissions. Returning nil leaves the interaction
+// unanswered.
+type ModalHandler func(i *discordgo.InteractionCreate, data discordgo.ModalSubmitInteractionData) *discordgo.InteractionResponse
+
+// AddCommand adds a slash command to the bot. It is registered with discord
+// on the next RegisterCommands call. Handlers receive the options of the
+// invoked subcommand, if any.
+func (b *Bot) AddCommand(cmd *discordgo.ApplicationCommand, handler CustomCommandHandler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, existing := range b.commands {
+		if existing.Name == cmd.Name {
+			b.commands = append(b.commands[:i], b.commands[i+1:]...)
+			break
+		}
+	}
+	b.commands = append(b.commands, cmd)
+	b.commandHandlers[cmd.Name] = handler
+}
+
+// AddSubcommand sets the handler of a subcommand of a command added through
+// AddCommand. The path is made of the space separated command, group and
+// subcommand names, for example "admin codes list".
+func (b *Bot) AddSubcommand(path string, handler CustomCommandHandler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.commandHandlers[path] = handler
+}
+
+// AddAutocomplete sets the autocomplete handler of a command or subcommand
+// path, see AddSubcommand.
+func (b *Bot) AddAutocomplete(path string, handler AutocompleteHandler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.autocompleteHandlers[path] = handler
+}
+
+// AddComponentHandler handles components whose custom ID is prefix, or starts
+// with prefix followed by a colon, so IDs can carry state such as
+// "unbind:confirm".
+func (b *Bot) AddComponentHandler(prefix string, handler ComponentHandler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.componentHandlers[prefix] = handler
+}
+
+// AddModalHandler handles modals the same way AddComponentHandler handles
+// components.
+func (b *Bot) AddModalHandler(prefix string, handler ModalHandler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.modalHandlers[prefix] = handler
+}
+
+func (b *Bot) handleInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	defer b.recoverHandler(s, i)
+
+	var response *discordgo.InteractionResponse
+	switch i.Type {
+	case discordgo.InteractionApplicationCommand:
+		data := i.ApplicationCommandData()
+		path, options := commandPath(data)
+		handler, ok := b.commandHandler(path)
+		if !ok {
+			return
+		}
+		response = &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: handler(i, optionMap(options)),
+		}
+	case discordgo.InteractionApplicationCommandAutocomplete:
+		data := i.ApplicationCommandData()
+		path, options := commandPath(data)
+		b.mu.RLock()
+		handler, ok := b.autocompleteHandlers[path]
+		if !ok {
+			handler, ok = b.autocompleteHandlers[data.Name]
+		}
+		b.mu.RUnlock()
+		if !ok {
+			return
+		}
+		var focused *discordgo.ApplicationCommandInteractionDataOption
+		for _, opt := range options {
+			if opt.Focused {
+				focused = opt
+			}
+		}
+		response = &discordgo.InteractionResponse{
+			Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+			Data: &discordgo.InteractionResponseData{
+				Choices: handler(i, focused, optionMap(options)),
+			},
+		}
+	case discordgo.InteractionMessageComponent:
+		data := i.MessageComponentData()
+		b.mu.RLock()
+		handler, ok := b.componentHandlers[customIdPrefix(data.CustomID)]
+		b.mu.RUnlock()
+		if !ok {
+			return
+		}
+		response = handler(i, data)
+	case discordgo.InteractionModalSubmit:
+		data := i.ModalSubmitData()
+		b.mu.RLock()
+		handler, ok := b.modalHandlers[customIdPrefix(data.CustomID)]
+		b.mu.RUnlock()
+		if !ok {
+			return
+		}
+		response = handler(i, data)
+	}
+	if response != nil {
+		_ = s.InteractionRespond(i.Interaction, response)
+	}
+}
+
+// commandHandler prefers the handler of the exact subcommand path and falls
+// back to the handler of the top level command.
+func (b *Bot) commandHandler(path string) (CustomCommandHandler, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if handler, ok := b.commandHandlers[path]; ok {
+		return handler, true
+	}
+	name, _, _ := strings.Cut(path, " ")
+	handler, ok := b.commandHandlers[name]
+	return handler, ok
+}
+
+// commandPath walks subcommand groups and subcommands, returning the path of
+// the invoked subcommand and its options.
+func commandPath(data discordgo.ApplicationCommandInteractionData) (string, []*discordgo.ApplicationCommandInteractionDataOption) {
+	path := data.Name
+	options := data.Options
+	for len(options) == 1 && (options[0].Type == discordgo.ApplicationCommandOptionSubCommandGroup || options[0].Type == discordgo.ApplicationCommandOptionSubCommand) {
+		path += " " + options[0].Name
+		options = options[0].Options
+	}
+	return path, options
+}
+
+func optionMap(options []*discordgo.ApplicationCommandInteractionDataOption) map[string]*discordgo.ApplicationCommandInteractionDataOption {
+	result := make(map[string]*discordgo.ApplicationCommandInteractionDataOption, len(options))
+	for _, opt := range options {
+		result[opt.Name] = opt
+	}
+	return result
+}
+
+func customIdPrefix(customId string) string {
+	prefix, _, _ := strings.Cut(customId, ":")
+	return prefix
+}
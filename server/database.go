@@ -0,0 +1,101 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"time"
+)
+
+const (
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+	DriverMySQL    = "mysql"
+)
+
+type DatabaseConfig struct {
+	// Driver is one of DriverSQLite, DriverPostgres or DriverMySQL.
+	// It is ignored when DB is set.
+	Driver string
+	DSN    string
+	// DB is an already opened connection to use instead of Driver and DSN.
+	DB *gorm.DB
+
+	// Pool settings are only applied when non-zero.
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+
+	// SkipMigrations disables applying pending migrations on startup, for
+	// deployments that run them separately through MigrateUp.
+	SkipMigrations bool
+}
+
+// OpenDatabase opens the configured database and applies the pool settings.
+// It does not run migrations.
+func OpenDatabase(cfg DatabaseConfig) (*gorm.DB, error) {
+	db := cfg.DB
+	if db == nil {
+		var dialector gorm.Dialector
+		switch cfg.Driver {
+		case DriverSQLite:
+			dialector = sqlite.Open(cfg.DSN)
+		case DriverPostgres:
+			dialector = postgres.Open(cfg.DSN)
+		case DriverMySQL:
+			dialector = mysql.Open(cfg.DSN)
+		default:
+			return nil, fmt.Errorf("unsupported database driver %q", cfg.Driver)
+		}
+		var err error
+		db, err = gorm.Open(dialector, &gorm.Config{TranslateError: true})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	maxOpenConns := cfg.MaxOpenConns
+	if maxOpenConns == 0 && db.Dialector.Name() == DriverSQLite {
+		// sqlite allows a single writer, so concurrent gin and discordgo
+		// goroutines would otherwise fail with "database is locked".
+		maxOpenConns = 1
+	}
+	if maxOpenConns != 0 {
+		sqlDB.SetMaxOpenConns(maxOpenConns)
+	}
+	if cfg.MaxIdleConns != 0 {
+		sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	}
+	if cfg.ConnMaxLifetime != 0 {
+		sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	}
+	if cfg.ConnMaxIdleTime != 0 {
+		sqlDB.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+	}
+	return db, nil
+}
+
+// isDuplicateKeyError reports whether err is a unique constraint violation.
+// It doesn't rely on gorm.Config.TranslateError, which may be disabled on
+// connections passed in through DatabaseConfig.DB.
+func isDuplicateKeyError(db *gorm.DB, err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return true
+	}
+	translator, ok := db.Dialector.(gorm.ErrorTranslator)
+	if !ok {
+		return false
+	}
+	return errors.Is(translator.Translate(err), gorm.ErrDuplicatedKey)
+}
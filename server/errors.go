@@ -1,10 +1,38 @@
 package server
 
+import "fmt"
+
+// Error codes of the ApplicationError values returned by the server. They are
+// also the keys of the localized error messages. API responses only carry the
+// HTTP status part, see ApplicationError.Code.
+const (
+    ErrorCodeAlreadyBound         = 40001
+    ErrorCodeAccountAlreadyBound  = 40002
+    ErrorCodeCodeAlreadyIssued    = 40003
+    ErrorCodeDiscordNotSpecified  = 40004
+    ErrorCodeXUIDNotSpecified     = 40005
+    ErrorCodeGamertagNotSpecified = 40006
+    ErrorCodeInvalidRequest       = 40007
+    ErrorCodeTokenAlreadyExists   = 40008
+    ErrorCodeUnknownScope         = 40009
+    ErrorCodeMissingScope         = 40301
+    ErrorCodeCodeNotFound         = 40401
+    ErrorCodeNoCodeForXUID        = 40402
+    ErrorCodeUserNotFound         = 40403
+    ErrorCodeTokenNotFound        = 40404
+    // ErrorCodeCodeExpired is no longer returned, code stores report expired
+    // codes as ErrorCodeCodeNotFound.
+    ErrorCodeCodeExpired          = 41001
+    ErrorCodeTooManyAttempts      = 42901
+)
+
 type ApplicationError struct {
     // ErrorCode should have its 3 first digits represent http status code.
     // For example, 50001 will return 500, 40401 will return 404...
     ErrorCode int
     Message   string
+    // Args are the values formatted into Message, reused for translations.
+    Args []interface{}
 }
 
 func NewApplicationError(errorCode int, message string) ApplicationError {
@@ -14,6 +42,33 @@ func NewApplicationError(errorCode int, message string) ApplicationError {
     }
 }
 
+// NewApplicationErrorf formats the message like fmt.Sprintf and keeps the
+// arguments, so translated messages can include them as well.
+func NewApplicationErrorf(errorCode int, format string, args ...interface{}) ApplicationError {
+    return ApplicationError{
+        ErrorCode: errorCode,
+        Message:   fmt.Sprintf(format, args...),
+        Args:      args,
+    }
+}
+
 func (err ApplicationError) Error() string {
     return err.Message
 }
+
+// Code returns the error code reported to API clients. Clients have always
+// received the HTTP status followed by 00, for example 40000 or 40400, so the
+// finer ErrorCode is kept internal.
+func (err ApplicationError) Code() int {
+    return err.ErrorCode / 100 * 100
+}
+
+// LocalizedMessage returns the message in the given language, falling back
+// to Message when there is no translation.
+func (err ApplicationError) LocalizedMessage(lang string) string {
+    format, ok := errorMessages[lang][err.ErrorCode]
+    if !ok {
+        return err.Message
+    }
+    return fmt.Sprintf(format, err.Args...)
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+)
+
+// Event is published by Service whenever a binding or code changes.
+type Event interface {
+	event()
+}
+
+type BindingCreated struct {
+	User *User
+}
+
+type BindingRemoved struct {
+	User *User
+}
+
+// GamertagChanged is published when the game server reports a new gamertag
+// for a bound account.
+type GamertagChanged struct {
+	User     *User
+	Previous string
+}
+
+type CodeIssued struct {
+	Code *CodeInformation
+}
+
+type CodeRevoked struct {
+	Code *CodeInformation
+}
+
+// CodeExpired is published when a code runs out without being used. The
+// in-memory and SQL stores report it from a periodic sweep, so it may arrive
+// up to a minute late. The Redis store leaves expiry to key TTLs and never
+// publishes it.
+type CodeExpired struct {
+	Code *CodeInformation
+}
+
+func (BindingCreated) event()  {}
+func (BindingRemoved) event()  {}
+func (GamertagChanged) event() {}
+func (CodeIssued) event()      {}
+func (CodeRevoked) event()     {}
+func (CodeExpired) event()     {}
+
+type EventHandler func(event Event)
+
+// Subscription identifies a subscribed handler, pass it to
+// Service.Unsubscribe to stop receiving events.
+type Subscription struct {
+	handler EventHandler
+}
+
+type eventBus struct {
+	logger *slog.Logger
+
+	mu   sync.RWMutex
+	subs []*Subscription
+}
+
+func newEventBus(logger *slog.Logger) *eventBus {
+	return &eventBus{logger: logger}
+}
+
+func (b *eventBus) subscribe(handler EventHandler) *Subscription {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	sub := &Subscription{handler: handler}
+	b.subs = append(b.subs, sub)
+	return sub
+}
+
+func (b *eventBus) unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, existing := range b.subs {
+		if existing == sub {
+			// Copy instead of shifting in place, publish may be iterating
+			// over the old slice.
+			subs := make([]*Subscription, 0, len(b.subs)-1)
+			subs = append(subs, b.subs[:i]...)
+			b.subs = append(subs, b.subs[i+1:]...)
+			return
+		}
+	}
+}
+
+func (b *eventBus) publish(event Event) {
+	b.mu.RLock()
+	subs := b.subs
+	b.mu.RUnlock()
+	for _, sub := range subs {
+		b.call(sub.handler, event)
+	}
+}
+
+// call runs a single handler, recovering from panics so a faulty subscriber
+// doesn't break the operation that published the event.
+func (b *eventBus) call(handler EventHandler, event Event) {
+	defer func() {
+		if rawErr := recover(); rawErr != nil {
+			b.logger.Error("Event handler panicked",
+				slog.String("event", fmt.Sprintf("%T", event)),
+				slog.Any("panic", rawErr),
+			)
+		}
+	}()
+	handler(event)
+}
+
+// On subscribes a handler that only receives events of type E.
+func On[E Event](s *Service, handler func(event E)) *Subscription {
+	return s.Subscribe(func(event Event) {
+		if e, ok := event.(E); ok {
+			handler(e)
+		}
+	})
+}
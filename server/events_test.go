@@ -0,0 +1,71 @@
+package server
+
+import "testing"
+
+func TestServicePanickingSubscriber(t *testing.T) {
+	s := newTestService(t)
+	s.Subscribe(func(event Event) {
+		panic("faulty subscriber")
+	})
+	var received []Event
+	s.Subscribe(func(event Event) {
+		received = append(received, event)
+	})
+
+	info, err := s.IssueCode("1000", "Steve")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := s.Bind(info.Code, "1")
+	if err != nil {
+		t.Fatalf("Bind with a panicking subscriber: %v", err)
+	}
+	if user.XUID != "1000" {
+		t.Fatalf("Bind returned %+v", user)
+	}
+	if len(received) != 3 {
+		t.Fatalf("later subscriber received %d events, want CodeIssued, BindingCreated and CodeRevoked", len(received))
+	}
+	if _, ok := received[1].(BindingCreated); !ok {
+		t.Fatalf("second event is %T, want BindingCreated", received[1])
+	}
+}
+
+func TestServiceUnsubscribe(t *testing.T) {
+	s := newTestService(t)
+	received := 0
+	sub := s.Subscribe(func(event Event) {
+		received++
+	})
+	if _, err := s.IssueCode("1000", ""); err != nil {
+		t.Fatal(err)
+	}
+	s.Unsubscribe(sub)
+	if _, err := s.IssueCode("2000", ""); err != nil {
+		t.Fatal(err)
+	}
+	if received != 1 {
+		t.Fatalf("received %d events, want only the one before Unsubscribe", received)
+	}
+}
+
+func TestOnFiltersByType(t *testing.T) {
+	s := newTestService(t)
+	var created []*User
+	On(s, func(event BindingCreated) {
+		created = append(created, event.User)
+	})
+	info, err := s.IssueCode("1000", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(created) != 0 {
+		t.Fatal("BindingCreated handler received CodeIssued")
+	}
+	if _, err := s.Bind(info.Code, "1"); err != nil {
+		t.Fatal(err)
+	}
+	if len(created) != 1 || created[0].Discord != "1" {
+		t.Fatalf("BindingCreated handler received %v", created)
+	}
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"github.com/Gewinum/go-df-discord/utils"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"time"
+)
+
+// legacyCodeInformation, legacyUser and legacyBinding mirror the response
+// types without json tags, so the legacy routes keep answering with the
+// capitalized field names they had before /v1.
+type legacyCodeInformation struct {
+	Code     string
+	XUID     string
+	Gamertag string
+	Issued   time.Time
+	Expires  time.Time
+}
+
+type legacyUser struct {
+	Discord  string
+	XUID     string
+	Gamertag string
+}
+
+type legacyBinding struct {
+	Discord string
+	XUID    string
+	Bound   time.Time
+	Unbound *time.Time
+}
+
+// legacyErrorInformation is ErrorInformation without json tags, the error
+// shape the legacy routes had before /v1.
+type legacyErrorInformation struct {
+	Code    int
+	Message string
+}
+
+// legacyFailurePayload is Payload with the error in the legacy shape.
+type legacyFailurePayload struct {
+	Error *legacyErrorInformation `json:"error"`
+	Data  interface{}             `json:"data"`
+}
+
+// legacyContextKey is set by deprecated, so recoveryMiddleware answers with
+// the legacy error shape.
+const legacyContextKey = "dfdiscord.legacy"
+
+// legacyPayload is SuccessPayload with the data converted to the legacy types.
+func legacyPayload(data interface{}) Payload {
+	return SuccessPayload(legacyData(data))
+}
+
+// legacyData converts response data to the legacy types.
+func legacyData(data interface{}) interface{} {
+	switch data := data.(type) {
+	case *CodeInformation:
+		return (*legacyCodeInformation)(data)
+	case *User:
+		return (*legacyUser)(data)
+	case []*Binding:
+		history := make([]*legacyBinding, 0, len(data))
+		for _, binding := range data {
+			history = append(history, (*legacyBinding)(binding))
+		}
+		return history
+	}
+	return data
+}
+
+// registerLegacy adds the unversioned routes, which take the raw request body
+// instead of JSON. They are kept for existing clients and point to their /v1
+// successors.
+func (s *Server) registerLegacy(r gin.IRouter) {
+	r.POST("/codes/issue", requireScope(ScopeCodesIssue), func(c *gin.Context) {
+		rawData, err := c.GetRawData()
+		utils.ErrorPanic(err)
+		xuid := string(rawData)
+		info, err := s.service.IssueCode(xuid, c.Query("gamertag"))
+		utils.ErrorPanic(err)
+		c.JSON(http.StatusOK, legacyPayload(info))
+	})
+
+	r.POST("/codes/check", requireScope(ScopeCodesRead), func(c *gin.Context) {
+		rawData, err := c.GetRawData()
+		utils.ErrorPanic(err)
+		code := string(rawData)
+		var info *CodeInformation
+		s.guardCodeAttempt(c, code, func() (err error) {
+			info, err = s.service.CheckCodeFor(code, c.Query("xuid"))
+			return err
+		})
+		c.JSON(http.StatusOK, legacyPayload(info))
+	})
+
+	r.POST("/codes/revoke", requireScope(ScopeCodesRevoke), func(c *gin.Context) {
+		rawData, err := c.GetRawData()
+		utils.ErrorPanic(err)
+		code := string(rawData)
+		s.guardCodeAttempt(c, code, func() error {
+			return s.service.RevokeCode(code)
+		})
+		c.JSON(http.StatusOK, legacyPayload(nil))
+	})
+
+	r.PUT("/users/xuid/:xuid/gamertag", requireScope(ScopeUsersWrite), func(c *gin.Context) {
+		xuid := xuidParam(c)
+		rawData, err := c.GetRawData()
+		utils.ErrorPanic(err)
+		gamertag := string(rawData)
+		if gamertag == "" {
+			panic(NewApplicationError(ErrorCodeGamertagNotSpecified, "Gamertag is not specified"))
+		}
+		user, err := s.service.UpdateGamertag(xuid, gamertag)
+		utils.ErrorPanic(err)
+		c.JSON(http.StatusOK, legacyPayload(user))
+	})
+
+	s.registerUserRoutes(r, legacyPayload)
+}
+
+// legacyFailure converts a failure payload to the legacy error shape.
+func legacyFailure(payload Payload) legacyFailurePayload {
+	return legacyFailurePayload{
+		Error: (*legacyErrorInformation)(payload.Error),
+		Data:  payload.Data,
+	}
+}
+
+// deprecated marks responses of legacy routes with the Deprecation header and
+// a link to the /v1 route, and marks the request for recoveryMiddleware.
+func deprecated(c *gin.Context) {
+	c.Set(legacyContextKey, true)
+	c.Header("Deprecation", "true")
+	c.Header("Link", "</v1"+c.Request.URL.Path+">; rel=\"successor-version\"")
+	c.Next()
+}
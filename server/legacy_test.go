@@ -0,0 +1,123 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testAccessToken = "test-token"
+
+func newTestServer(t *testing.T) (*Server, http.Handler) {
+	t.Helper()
+	return newTestServerWithOpts(t, &Opts{})
+}
+
+func newTestServerWithOpts(t *testing.T, opts *Opts) (*Server, http.Handler) {
+	t.Helper()
+	opts.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	opts.Repo = newTestRepository(t)
+	FillEmptyOpts(opts)
+	// NewServer would connect the bot to discord.
+	s := &Server{
+		accessTokenHash: hashToken(testAccessToken),
+		opts:            opts,
+		service:         NewService(opts.Repo, opts.CodeStr, opts.Logger),
+		codeAttempts:    newAttemptLimiter(opts.CodeAttempts, opts.AttemptLockout, opts.MaxAttemptLockout),
+	}
+	handler, err := s.GetHttpHandler(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, handler
+}
+
+// serveTest sends a request with the access token and decodes Payload.Data.
+func serveTest(t *testing.T, handler http.Handler, method, path, body string) map[string]interface{} {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+testAccessToken)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("%s %s: status %d, body %s", method, path, rec.Code, rec.Body)
+	}
+	var payload struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &payload); err != nil {
+		t.Fatal(err)
+	}
+	return payload.Data
+}
+
+func TestLegacyResponsesKeepFieldNames(t *testing.T) {
+	s, handler := newTestServer(t)
+	if _, err := s.service.repo.CreateUser("1", "1000", "Steve"); err != nil {
+		t.Fatal(err)
+	}
+
+	legacy := serveTest(t, handler, http.MethodGet, "/users/xuid/1000", "")
+	if legacy["XUID"] != "1000" || legacy["Discord"] != "1" || legacy["Gamertag"] != "Steve" {
+		t.Fatalf("legacy user = %v, want capitalized field names", legacy)
+	}
+	v1 := serveTest(t, handler, http.MethodGet, "/v1/users/xuid/1000", "")
+	if v1["xuid"] != "1000" || v1["discord"] != "1" || v1["gamertag"] != "Steve" {
+		t.Fatalf("v1 user = %v, want lowercase field names", v1)
+	}
+
+	code := serveTest(t, handler, http.MethodPost, "/codes/issue", "2000")
+	if code["XUID"] != "2000" || code["Code"] == nil || code["Expires"] == nil {
+		t.Fatalf("legacy code = %v, want capitalized field names", code)
+	}
+}
+
+func TestLegacyErrorsKeepFieldNames(t *testing.T) {
+	_, handler := newTestServer(t)
+	for path, shape := range map[string][]string{
+		"/users/xuid/999":    {"Code", "Message"},
+		"/v1/users/xuid/999": {"code", "message"},
+	} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+testAccessToken)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusNotFound {
+			t.Fatalf("GET %s: status %d, want %d", path, rec.Code, http.StatusNotFound)
+		}
+		var payload struct {
+			Error map[string]interface{} `json:"error"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &payload); err != nil {
+			t.Fatal(err)
+		}
+		code, message := shape[0], shape[1]
+		if len(payload.Error) != 2 || payload.Error[code] != float64(40400) || payload.Error[message] == "" || payload.Error[message] == nil {
+			t.Fatalf("GET %s: error = %v, want %s 40400 and a %s", path, payload.Error, code, message)
+		}
+	}
+}
+
+func TestLegacyHistoryKeepsBindings(t *testing.T) {
+	s, handler := newTestServer(t)
+	if _, err := s.service.repo.CreateUser("1", "1000", ""); err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/users/xuid/1000/history", nil)
+	req.Header.Set("Authorization", "Bearer "+testAccessToken)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	var payload struct {
+		Data []map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &payload); err != nil {
+		t.Fatal(err)
+	}
+	if len(payload.Data) != 1 || payload.Data[0]["XUID"] != "1000" || payload.Data[0]["Discord"] != "1" {
+		t.Fatalf("legacy history = %s, want the binding with capitalized field names", rec.Body)
+	}
+}
@@ -0,0 +1,248 @@
+package server
+
+import (
+	"github.com/bwmarrin/discordgo"
+	"golang.org/x/text/language"
+	"strings"
+)
+
+const defaultLanguage = "en"
+
+var supportedLanguages = language.NewMatcher([]language.Tag{
+	language.English,
+	language.German,
+	language.Russian,
+})
+
+// errorMessages holds the translations of ApplicationError messages keyed by
+// error code. English messages come from the errors themselves.
+var errorMessages = map[string]map[int]string{
+	"de": {
+		ErrorCodeAlreadyBound:         "Der Discord-Account oder die XUID ist bereits verknüpft",
+		ErrorCodeAccountAlreadyBound:  "Der Minecraft-Account ist bereits mit der ID %s verknüpft",
+		ErrorCodeCodeAlreadyIssued:    "Der Code %s wurde bereits ausgestellt",
+		ErrorCodeDiscordNotSpecified:  "Die Discord-ID wurde nicht angegeben",
+		ErrorCodeXUIDNotSpecified:     "Die XUID wurde nicht angegeben",
+		ErrorCodeGamertagNotSpecified: "Der Gamertag wurde nicht angegeben",
+		ErrorCodeInvalidRequest:       "Ungültige Anfrage: %s",
+		ErrorCodeTokenAlreadyExists:   "Der Token %s existiert bereits",
+		ErrorCodeUnknownScope:         "Unbekannter Scope %s",
+		ErrorCodeMissingScope:         "Dem Token fehlt der Scope %s",
+		ErrorCodeCodeNotFound:         "Der Code existiert nicht",
+		ErrorCodeNoCodeForXUID:        "Für diese XUID gibt es keinen Code",
+		ErrorCodeUserNotFound:         "Benutzer nicht gefunden",
+		ErrorCodeTokenNotFound:        "Token nicht gefunden",
+		ErrorCodeCodeExpired:          "Der Code ist abgelaufen",
+		ErrorCodeTooManyAttempts:      "Zu viele Fehlversuche, versuche es in %s erneut",
+	},
+	"ru": {
+		ErrorCodeAlreadyBound:         "Discord или XUID уже привязаны",
+		ErrorCodeAccountAlreadyBound:  "Аккаунт Minecraft уже привязан к ID %s",
+		ErrorCodeCodeAlreadyIssued:    "Код %s уже выдан",
+		ErrorCodeDiscordNotSpecified:  "Discord ID не указан",
+		ErrorCodeXUIDNotSpecified:     "XUID не указан",
+		ErrorCodeGamertagNotSpecified: "Gamertag не указан",
+		ErrorCodeInvalidRequest:       "Некорректный запрос: %s",
+		ErrorCodeTokenAlreadyExists:   "Токен %s уже существует",
+		ErrorCodeUnknownScope:         "Неизвестная область доступа %s",
+		ErrorCodeMissingScope:         "У токена нет области доступа %s",
+		ErrorCodeCodeNotFound:         "Код не существует",
+		ErrorCodeNoCodeForXUID:        "Для этого XUID нет кода",
+		ErrorCodeUserNotFound:         "Пользователь не найден",
+		ErrorCodeTokenNotFound:        "Токен не найден",
+		ErrorCodeCodeExpired:          "Срок действия кода истёк",
+		ErrorCodeTooManyAttempts:      "Слишком много неудачных попыток, повторите через %s",
+	},
+}
+
+// botMessages holds the texts of bot responses.
+var botMessages = map[string]map[string]string{
+	"en": {
+		"something_went_wrong": "Something went wrong",
+		"unknown":              "Unknown",
+		"button_confirm":       "Confirm",
+		"button_cancel":        "Cancel",
+		"button_unbind":        "Unbind",
+		"bind_confirm":         "Do you want to bind this minecraft account?",
+		"bind_created":         "Binding has been created",
+		"bind_cancelled":       "Binding has been cancelled",
+		"bind_expired":         "Binding confirmation has expired, run /bind again",
+		"unbind_confirm":       "Do you want to remove this binding?",
+		"unbind_removed":       "Binding has been removed",
+		"unbind_cancelled":     "Unbinding has been cancelled",
+		"whois_title":          "Minecraft account",
+		"whois_forbidden":      "You are not allowed to look up other members",
+		"whois_usage":          "Specify either a user or a gamertag",
+		"reconcile_started":    "Role reconciliation has been started",
+		"admin_forbidden":      "You are not allowed to use admin commands",
+		"admin_codes_title":    "Outstanding codes",
+		"admin_codes_empty":    "There are no outstanding codes",
+		"admin_codes_more":     "…and %d more",
+		"admin_code_revoked":   "Code %s has been revoked",
+	},
+	"de": {
+		"something_went_wrong": "Etwas ist schiefgelaufen",
+		"unknown":              "Unbekannt",
+		"button_confirm":       "Bestätigen",
+		"button_cancel":        "Abbrechen",
+		"button_unbind":        "Entfernen",
+		"bind_confirm":         "Möchtest du diesen Minecraft-Account verknüpfen?",
+		"bind_created":         "Die Verknüpfung wurde erstellt",
+		"bind_cancelled":       "Die Verknüpfung wurde abgebrochen",
+		"bind_expired":         "Die Bestätigung ist abgelaufen, führe /bind erneut aus",
+		"unbind_confirm":       "Möchtest du diese Verknüpfung entfernen?",
+		"unbind_removed":       "Die Verknüpfung wurde entfernt",
+		"unbind_cancelled":     "Das Entfernen wurde abgebrochen",
+		"whois_title":          "Minecraft-Account",
+		"whois_forbidden":      "Du darfst andere Mitglieder nicht nachschlagen",
+		"whois_usage":          "Gib entweder einen Benutzer oder einen Gamertag an",
+		"reconcile_started":    "Der Rollenabgleich wurde gestartet",
+		"admin_forbidden":      "Du darfst keine Admin-Befehle verwenden",
+		"admin_codes_title":    "Offene Codes",
+		"admin_codes_empty":    "Es gibt keine offenen Codes",
+		"admin_codes_more":     "…und %d weitere",
+		"admin_code_revoked":   "Der Code %s wurde widerrufen",
+	},
+	"ru": {
+		"something_went_wrong": "Что-то пошло не так",
+		"unknown":              "Неизвестно",
+		"button_confirm":       "Подтвердить",
+		"button_cancel":        "Отмена",
+		"button_unbind":        "Отвязать",
+		"bind_confirm":         "Привязать этот аккаунт Minecraft?",
+		"bind_created":         "Привязка создана",
+		"bind_cancelled":       "Привязка отменена",
+		"bind_expired":         "Время подтверждения истекло, выполните /bind ещё раз",
+		"unbind_confirm":       "Удалить эту привязку?",
+		"unbind_removed":       "Привязка удалена",
+		"unbind_cancelled":     "Удаление привязки отменено",
+		"whois_title":          "Аккаунт Minecraft",
+		"whois_forbidden":      "Вам нельзя просматривать других участников",
+		"whois_usage":          "Укажите либо пользователя, либо gamertag",
+		"reconcile_started":    "Синхронизация ролей запущена",
+		"admin_forbidden":      "Вам нельзя использовать команды администратора",
+		"admin_codes_title":    "Действующие коды",
+		"admin_codes_empty":    "Действующих кодов нет",
+		"admin_codes_more":     "…и ещё %d",
+		"admin_code_revoked":   "Код %s отозван",
+	},
+}
+
+// commandLocalizations holds command and option names and descriptions.
+// Keys are the command name, optionally followed by ".<option>", and
+// ".description" for descriptions.
+var commandLocalizations = map[discordgo.Locale]map[string]string{
+	discordgo.German: {
+		"bind":                          "verknüpfen",
+		"bind.description":              "Verknüpfe deinen Minecraft-Account mit deinem Discord-Account",
+		"bind.code.description":         "Code aus dem Spiel",
+		"unbind":                        "trennen",
+		"unbind.description":            "Trenne deinen Minecraft-Account von deinem Discord-Account",
+		"whois.description":             "Zeige die Verknüpfung eines Mitglieds oder Spielers",
+		"whois.user":                    "benutzer",
+		"whois.user.description":        "Discord-Mitglied",
+		"whois.gamertag.description":    "Minecraft-Gamertag",
+		"profile":                       "profil",
+		"profile.description":           "Zeige den mit dir verknüpften Minecraft-Account",
+		"reconcile-roles.description":   "Vergib die Rollen aller verknüpften Mitglieder erneut",
+		"admin.description":             "Verknüpfungen und Codes verwalten",
+		"admin.bind.description":        "Einen Minecraft-Account mit einem Mitglied verknüpfen",
+		"admin.unbind.description":      "Die Verknüpfung eines Mitglieds entfernen",
+		"admin.unbind-xuid.description": "Die Verknüpfung eines Minecraft-Accounts entfernen",
+		"admin.codes.description":       "Offene Codes verwalten",
+	},
+	discordgo.Russian: {
+		"bind":                          "привязать",
+		"bind.description":              "Привязать аккаунт Minecraft к аккаунту Discord",
+		"bind.code":                     "код",
+		"bind.code.description":         "код из игры",
+		"unbind":                        "отвязать",
+		"unbind.description":            "Отвязать аккаунт Minecraft от аккаунта Discord",
+		"whois.description":             "Показать привязку участника или игрока",
+		"whois.user":                    "пользователь",
+		"whois.user.description":        "участник Discord",
+		"whois.gamertag.description":    "gamertag Minecraft",
+		"profile":                       "профиль",
+		"profile.description":           "Показать привязанный аккаунт Minecraft",
+		"reconcile-roles.description":   "Заново выдать роли всем привязанным участникам",
+		"admin.description":             "Управление привязками и кодами",
+		"admin.bind.description":        "Привязать аккаунт Minecraft к участнику",
+		"admin.unbind.description":      "Удалить привязку участника",
+		"admin.unbind-xuid.description": "Удалить привязку аккаунта Minecraft",
+		"admin.codes.description":       "Управление действующими кодами",
+	},
+}
+
+// tr returns the bot message in the given language, falling back to English.
+func tr(lang, key string) string {
+	if message, ok := botMessages[lang][key]; ok {
+		return message
+	}
+	return botMessages[defaultLanguage][key]
+}
+
+// localeLanguage maps a discord locale such as "en-US" to its language.
+func localeLanguage(locale discordgo.Locale) string {
+	lang, _, _ := strings.Cut(string(locale), "-")
+	if _, ok := botMessages[lang]; !ok {
+		return defaultLanguage
+	}
+	return lang
+}
+
+func interactionLanguage(i *discordgo.InteractionCreate) string {
+	return localeLanguage(i.Locale)
+}
+
+// acceptLanguage picks the best supported language of an Accept-Language
+// header.
+func acceptLanguage(header string) string {
+	tags, _, err := language.ParseAcceptLanguage(header)
+	if err != nil || len(tags) == 0 {
+		return defaultLanguage
+	}
+	tag, _, _ := supportedLanguages.Match(tags...)
+	base, _ := tag.Base()
+	return base.String()
+}
+
+// localizeCommand fills the name and description localizations of the
+// command and its options from commandLocalizations.
+func localizeCommand(cmd *discordgo.ApplicationCommand) {
+	var names, descriptions map[discordgo.Locale]string
+	if cmd.NameLocalizations != nil {
+		names = *cmd.NameLocalizations
+	}
+	if cmd.DescriptionLocalizations != nil {
+		descriptions = *cmd.DescriptionLocalizations
+	}
+	if names = commandLocalization(cmd.Name, names); names != nil {
+		cmd.NameLocalizations = &names
+	}
+	if descriptions = commandLocalization(cmd.Name+".description", descriptions); descriptions != nil {
+		cmd.DescriptionLocalizations = &descriptions
+	}
+	for _, opt := range cmd.Options {
+		key := cmd.Name + "." + opt.Name
+		opt.NameLocalizations = commandLocalization(key, opt.NameLocalizations)
+		opt.DescriptionLocalizations = commandLocalization(key+".description", opt.DescriptionLocalizations)
+	}
+}
+
+// commandLocalization adds the translations of key to the existing ones. It
+// returns nil when there are none at all.
+func commandLocalization(key string, existing map[discordgo.Locale]string) map[discordgo.Locale]string {
+	localizations := make(map[discordgo.Locale]string, len(existing))
+	for locale, value := range existing {
+		localizations[locale] = value
+	}
+	for locale, messages := range commandLocalizations {
+		if value, ok := messages[key]; ok {
+			localizations[locale] = value
+		}
+	}
+	if len(localizations) == 0 {
+		return nil
+	}
+	return localizations
+}
@@ -0,0 +1,330 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"time"
+)
+
+// Migration is a single versioned schema change. Migrations must never be
+// edited once released, add a new one instead.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+type SchemaMigration struct {
+	Version   int `gorm:"primarykey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// Migrations returns all known migrations ordered by version.
+func Migrations() []Migration {
+	return []Migration{
+		{
+			Version: 1,
+			Name:    "create users table",
+			Up: func(tx *gorm.DB) error {
+				// Databases created before migrations existed already have
+				// this table from AutoMigrate.
+				if tx.Migrator().HasTable(&migrationUserData{}) {
+					return nil
+				}
+				return tx.Migrator().CreateTable(&migrationUserData{})
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable(&migrationUserData{})
+			},
+		},
+		{
+			Version: 2,
+			Name:    "add unique discord and xuid constraints",
+			Up:      addUniqueUserConstraints,
+			Down:    dropUniqueUserConstraints,
+		},
+		{
+			Version: 3,
+			Name:    "create codes table",
+			Up: func(tx *gorm.DB) error {
+				if tx.Migrator().HasTable(&migrationCodeData{}) {
+					return nil
+				}
+				return tx.Migrator().CreateTable(&migrationCodeData{})
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable(&migrationCodeData{})
+			},
+		},
+		{
+			Version: 4,
+			Name:    "add gamertag columns",
+			Up: func(tx *gorm.DB) error {
+				for _, table := range []string{"user_data", "codes"} {
+					err := tx.Exec("ALTER TABLE " + table + " ADD COLUMN gamertag VARCHAR(255) NOT NULL DEFAULT ''").Error
+					if err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			Down: func(tx *gorm.DB) error {
+				// gorm's sqlite migrator drops columns by recreating the table,
+				// which loses the partial indexes, so use plain SQL instead.
+				for _, table := range []string{"user_data", "codes"} {
+					err := tx.Exec("ALTER TABLE " + table + " DROP COLUMN gamertag").Error
+					if err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			Version: 5,
+			Name:    "create api tokens table",
+			Up: func(tx *gorm.DB) error {
+				return tx.Migrator().CreateTable(&migrationTokenData{})
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable(&migrationTokenData{})
+			},
+		},
+	}
+}
+
+// MigrationVersion returns the version of the latest applied migration, or 0
+// if none were applied yet.
+func MigrationVersion(db *gorm.DB) (int, error) {
+	err := db.AutoMigrate(&SchemaMigration{})
+	if err != nil {
+		return 0, err
+	}
+	var version int
+	err = db.Model(&SchemaMigration{}).Select("COALESCE(MAX(version), 0)").Scan(&version).Error
+	if err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// MigrateUp applies every pending migration.
+func MigrateUp(db *gorm.DB) error {
+	migrations := Migrations()
+	return MigrateTo(db, migrations[len(migrations)-1].Version)
+}
+
+// MigrateDown reverts the given amount of applied migrations.
+func MigrateDown(db *gorm.DB, steps int) error {
+	current, err := MigrationVersion(db)
+	if err != nil {
+		return err
+	}
+	target := 0
+	migrations := Migrations()
+	for i := len(migrations) - 1; i >= 0; i-- {
+		if migrations[i].Version > current {
+			continue
+		}
+		if steps == 0 {
+			target = migrations[i].Version
+			break
+		}
+		steps--
+	}
+	return MigrateTo(db, target)
+}
+
+// MigrateTo applies or reverts migrations until the schema is at the given
+// version. Every migration runs in its own transaction. On PostgreSQL and
+// MySQL a database lock keeps several instances from migrating at once;
+// SQLite has no such lock, so only one process may migrate a file at a time.
+func MigrateTo(db *gorm.DB, target int) error {
+	return withMigrationLock(db, func(db *gorm.DB) error {
+		return migrateTo(db, target)
+	})
+}
+
+func migrateTo(db *gorm.DB, target int) error {
+	current, err := MigrationVersion(db)
+	if err != nil {
+		return err
+	}
+	migrations := Migrations()
+
+	if target >= current {
+		for _, m := range migrations {
+			if m.Version <= current || m.Version > target {
+				continue
+			}
+			err = db.Transaction(func(tx *gorm.DB) error {
+				err := m.Up(tx)
+				if err != nil {
+					return err
+				}
+				return tx.Create(&SchemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+			}
+		}
+		return nil
+	}
+
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if m.Version > current || m.Version <= target {
+			continue
+		}
+		err = db.Transaction(func(tx *gorm.DB) error {
+			err := m.Down(tx)
+			if err != nil {
+				return err
+			}
+			return tx.Delete(&SchemaMigration{}, "version = ?", m.Version).Error
+		})
+		if err != nil {
+			return fmt.Errorf("reverting migration %d (%s): %w", m.Version, m.Name, err)
+		}
+	}
+	return nil
+}
+
+// migrationLockName identifies the migration lock, as a MySQL lock name and
+// hashed into a PostgreSQL advisory lock key.
+const migrationLockName = "dfdiscord_migrations"
+
+// withMigrationLock runs fn on a single connection that holds the migration
+// lock. The version is read after taking the lock, so a migrator that waited
+// sees what the previous one applied.
+func withMigrationLock(db *gorm.DB, fn func(conn *gorm.DB) error) error {
+	return db.Connection(func(conn *gorm.DB) error {
+		// Connection doesn't start a new session, without one conditions
+		// would pile up across statements.
+		conn = conn.Session(&gorm.Session{})
+		switch conn.Dialector.Name() {
+		case DriverPostgres:
+			err := conn.Exec("SELECT pg_advisory_lock(hashtext(?))", migrationLockName).Error
+			if err != nil {
+				return fmt.Errorf("acquiring migration lock: %w", err)
+			}
+			defer conn.Exec("SELECT pg_advisory_unlock(hashtext(?))", migrationLockName)
+		case DriverMySQL:
+			var acquired int
+			err := conn.Raw("SELECT GET_LOCK(?, 300)", migrationLockName).Scan(&acquired).Error
+			if err != nil {
+				return fmt.Errorf("acquiring migration lock: %w", err)
+			}
+			if acquired != 1 {
+				return errors.New("acquiring migration lock: timed out")
+			}
+			defer conn.Exec("SELECT RELEASE_LOCK(?)", migrationLockName)
+		}
+		return fn(conn)
+	})
+}
+
+// migrationUserData, migrationCodeData and migrationTokenData freeze the table layouts at the time
+// their migrations were written, so later model changes don't alter history.
+type migrationUserData struct {
+	gorm.Model
+	Discord string
+	XUID    string `gorm:"column:xuid"`
+}
+
+func (migrationUserData) TableName() string {
+	return "user_data"
+}
+
+// Indexed strings of migrationCodeData and migrationTokenData need a size,
+// MySQL can't index the longtext gorm picks otherwise.
+type migrationCodeData struct {
+	ID      uint   `gorm:"primarykey"`
+	Code    string `gorm:"size:191;uniqueIndex:idx_codes_code"`
+	XUID    string `gorm:"column:xuid;size:191;uniqueIndex:idx_codes_xuid"`
+	Issued  time.Time
+	Expires time.Time `gorm:"index:idx_codes_expires"`
+}
+
+func (migrationCodeData) TableName() string {
+	return "codes"
+}
+
+type migrationTokenData struct {
+	ID      uint   `gorm:"primarykey"`
+	Name    string `gorm:"size:191;uniqueIndex:idx_api_tokens_name"`
+	Hash    string `gorm:"size:191;uniqueIndex:idx_api_tokens_hash"`
+	Scopes  string
+	Created time.Time
+}
+
+func (migrationTokenData) TableName() string {
+	return "api_tokens"
+}
+
+func addUniqueUserConstraints(tx *gorm.DB) error {
+	// Unbinding soft-deletes rows, so uniqueness only applies to active
+	// bindings. Duplicates that slipped in earlier are unbound, keeping the
+	// oldest binding.
+	for _, column := range []string{"discord", "xuid"} {
+		err := tx.Exec(fmt.Sprintf(
+			"UPDATE user_data SET deleted_at = ? WHERE deleted_at IS NULL AND id NOT IN "+
+				"(SELECT id FROM (SELECT MIN(id) AS id FROM user_data WHERE deleted_at IS NULL GROUP BY %s) AS kept)",
+			column,
+		), time.Now()).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	if tx.Dialector.Name() == DriverMySQL {
+		// MySQL has no partial indexes, so index generated columns that are
+		// NULL for deleted rows instead. The columns from AutoMigrate are
+		// longtext, which MySQL can't index, hence VARCHAR(191): the longest
+		// utf8mb4 key within the 767 byte limit of older InnoDB versions.
+		statements := []string{
+			"ALTER TABLE user_data ADD COLUMN active_discord VARCHAR(191) AS (IF(deleted_at IS NULL, discord, NULL)) STORED",
+			"ALTER TABLE user_data ADD COLUMN active_xuid VARCHAR(191) AS (IF(deleted_at IS NULL, xuid, NULL)) STORED",
+			"CREATE UNIQUE INDEX idx_user_data_discord ON user_data (active_discord)",
+			"CREATE UNIQUE INDEX idx_user_data_xuid ON user_data (active_xuid)",
+		}
+		for _, statement := range statements {
+			err := tx.Exec(statement).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	err := tx.Exec("CREATE UNIQUE INDEX idx_user_data_discord ON user_data (discord) WHERE deleted_at IS NULL").Error
+	if err != nil {
+		return err
+	}
+	return tx.Exec("CREATE UNIQUE INDEX idx_user_data_xuid ON user_data (xuid) WHERE deleted_at IS NULL").Error
+}
+
+func dropUniqueUserConstraints(tx *gorm.DB) error {
+	err := tx.Migrator().DropIndex(&migrationUserData{}, "idx_user_data_discord")
+	if err != nil {
+		return err
+	}
+	err = tx.Migrator().DropIndex(&migrationUserData{}, "idx_user_data_xuid")
+	if err != nil {
+		return err
+	}
+	if tx.Dialector.Name() == DriverMySQL {
+		err = tx.Exec("ALTER TABLE user_data DROP COLUMN active_discord, DROP COLUMN active_xuid").Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
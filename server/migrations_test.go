@@ -0,0 +1,110 @@
+package server
+
+import (
+	"gorm.io/gorm"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func openTestDatabase(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := OpenDatabase(DatabaseConfig{
+		Driver: DriverSQLite,
+		DSN:    "file:" + strings.ReplaceAll(t.Name(), "/", "_") + "?mode=memory&cache=shared",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func requireMigrationVersion(t *testing.T, db *gorm.DB, want int) {
+	t.Helper()
+	version, err := MigrationVersion(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != want {
+		t.Fatalf("schema at version %d, want %d", version, want)
+	}
+}
+
+func TestMigrationsRoundTrip(t *testing.T) {
+	db := openTestDatabase(t)
+	migrations := Migrations()
+	latest := migrations[len(migrations)-1].Version
+
+	if err := MigrateUp(db); err != nil {
+		t.Fatal(err)
+	}
+	requireMigrationVersion(t, db, latest)
+
+	if err := MigrateDown(db, 1); err != nil {
+		t.Fatal(err)
+	}
+	requireMigrationVersion(t, db, migrations[len(migrations)-2].Version)
+
+	if err := MigrateTo(db, 0); err != nil {
+		t.Fatal(err)
+	}
+	requireMigrationVersion(t, db, 0)
+	for _, table := range []string{"user_data", "codes", "api_tokens"} {
+		if db.Migrator().HasTable(table) {
+			t.Fatalf("table %s left after reverting every migration", table)
+		}
+	}
+
+	if err := MigrateUp(db); err != nil {
+		t.Fatalf("migrating up again: %v", err)
+	}
+	requireMigrationVersion(t, db, latest)
+	// The partial indexes survive the round trip.
+	repo := &defaultRepository{db: db}
+	if _, err := repo.CreateUser("1", "1000", ""); err != nil {
+		t.Fatal(err)
+	}
+	err := db.Create(&UserData{Discord: "1", XUID: "2000"}).Error
+	if !isDuplicateKeyError(db, err) {
+		t.Fatalf("duplicate discord after round trip: got %v, want a duplicate key error", err)
+	}
+}
+
+// TestMigrationsUpgradeAutoMigratedDatabase starts from a table created by
+// AutoMigrate before migrations existed, which had no unique constraints.
+func TestMigrationsUpgradeAutoMigratedDatabase(t *testing.T) {
+	db := openTestDatabase(t)
+	if err := db.AutoMigrate(&migrationUserData{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range []migrationUserData{
+		{Model: gorm.Model{ID: 1}, Discord: "a", XUID: "1000"},
+		{Model: gorm.Model{ID: 2}, Discord: "a", XUID: "2000"},
+		{Model: gorm.Model{ID: 3}, Discord: "b", XUID: "1000"},
+		{Model: gorm.Model{ID: 4}, Discord: "c", XUID: "3000"},
+	} {
+		if err := db.Create(&row).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := MigrateUp(db); err != nil {
+		t.Fatal(err)
+	}
+	var active []uint
+	err := db.Model(&migrationUserData{}).Order("id").Pluck("id", &active).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The oldest binding of each account is kept, later duplicates unbound.
+	if !slices.Equal(active, []uint{1, 4}) {
+		t.Fatalf("active bindings %v, want [1 4]", active)
+	}
+	history, err := (&defaultRepository{db: db}).BindingHistoryByDiscord("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("history of a has %d bindings, want the kept and the unbound one", len(history))
+	}
+}
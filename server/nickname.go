@@ -0,0 +1,100 @@
+package server
+
+import (
+	"github.com/bwmarrin/discordgo"
+	"strings"
+)
+
+// maxNicknameLength is the longest nickname discord accepts.
+const maxNicknameLength = 32
+
+// syncNickname sets the member's guild nickname from Opts.NicknameTemplate.
+func (b *Bot) syncNickname(user *User) {
+	if user.Gamertag == "" {
+		return
+	}
+	member, ok := b.manageableMember(user.Discord)
+	if !ok {
+		return
+	}
+	nickname := strings.NewReplacer(
+		"{gamertag}", user.Gamertag,
+		"{discord}", member.User.Username,
+	).Replace(b.opts.NicknameTemplate)
+	if runes := []rune(nickname); len(runes) > maxNicknameLength {
+		nickname = string(runes[:maxNicknameLength])
+	}
+	if member.Nick == nickname {
+		return
+	}
+	err := b.retryMemberUpdate(func() error {
+		return b.api.GuildMemberNickname(b.opts.GuildID, user.Discord, nickname)
+	})
+	if err != nil {
+		b.opts.Logger.Error("Could not update nickname", "discord", user.Discord, "error", err)
+	}
+}
+
+func (b *Bot) resetNickname(discordId string) {
+	member, ok := b.manageableMember(discordId)
+	if !ok || member.Nick == "" {
+		return
+	}
+	err := b.retryMemberUpdate(func() error {
+		return b.api.GuildMemberNickname(b.opts.GuildID, discordId, "")
+	})
+	if err != nil {
+		b.opts.Logger.Error("Could not reset nickname", "discord", discordId, "error", err)
+	}
+}
+
+// manageableMember returns the guild member if the bot is allowed to change
+// their nickname: discord rejects edits of the guild owner and of members
+// whose highest role is not below the bot's.
+func (b *Bot) manageableMember(discordId string) (*discordgo.Member, bool) {
+	member, err := b.api.GuildMember(b.opts.GuildID, discordId)
+	if err != nil {
+		if !isUnknownMember(err) {
+			b.opts.Logger.Error("Could not fetch guild member", "discord", discordId, "error", err)
+		}
+		return nil, false
+	}
+	guild, err := b.api.State.Guild(b.opts.GuildID)
+	if err != nil {
+		guild, err = b.api.Guild(b.opts.GuildID)
+		if err != nil {
+			b.opts.Logger.Error("Could not fetch guild", "guild", b.opts.GuildID, "error", err)
+			return nil, false
+		}
+	}
+	if guild.OwnerID == discordId {
+		return nil, false
+	}
+	self, err := b.api.GuildMember(b.opts.GuildID, b.api.State.User.ID)
+	if err != nil {
+		b.opts.Logger.Error("Could not fetch bot member", "error", err)
+		return nil, false
+	}
+	roles, err := b.api.GuildRoles(b.opts.GuildID)
+	if err != nil {
+		b.opts.Logger.Error("Could not fetch guild roles", "guild", b.opts.GuildID, "error", err)
+		return nil, false
+	}
+	if highestRolePosition(roles, self.Roles) <= highestRolePosition(roles, member.Roles) {
+		b.opts.Logger.Debug("Skipping nickname of member ranked above the bot", "discord", discordId)
+		return nil, false
+	}
+	return member, true
+}
+
+func highestRolePosition(roles []*discordgo.Role, memberRoles []string) int {
+	highest := 0
+	for _, role := range roles {
+		for _, id := range memberRoles {
+			if role.ID == id && role.Position > highest {
+				highest = role.Position
+			}
+		}
+	}
+	return highest
+}
@@ -0,0 +1,331 @@
+package server
+
+import (
+	_ "embed"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+//go:embed docs.html
+var docsPage []byte
+
+// apiOperation describes a route for the OpenAPI document.
+type apiOperation struct {
+	method  string
+	path    string
+	summary string
+	tag     string
+	// scope is the scope the token needs, empty when any token will do.
+	scope string
+	// request is the JSON body type, rawRequest describes a plain text body
+	// of the legacy routes instead.
+	request    interface{}
+	rawRequest string
+	// query lists optional query parameters.
+	query []string
+	// response is the type of Payload.Data, nil when there is none.
+	response interface{}
+	// legacyResponse is the response of the legacy alias of userOperations.
+	legacyResponse interface{}
+	deprecated     bool
+}
+
+var userOperations = []apiOperation{
+	{method: http.MethodGet, path: "/users/discord/:id", summary: "Get the binding of a discord account", scope: ScopeUsersRead, tag: "users", response: User{}, legacyResponse: legacyUser{}},
+	{method: http.MethodGet, path: "/users/xuid/:xuid", summary: "Get the binding of a minecraft account", scope: ScopeUsersRead, tag: "users", response: User{}, legacyResponse: legacyUser{}},
+	{method: http.MethodDelete, path: "/users/discord/:id", summary: "Remove the binding of a discord account", scope: ScopeUsersWrite, tag: "users"},
+	{method: http.MethodDelete, path: "/users/xuid/:xuid", summary: "Remove the binding of a minecraft account", scope: ScopeUsersWrite, tag: "users"},
+	{method: http.MethodGet, path: "/users/discord/:id/history", summary: "List every binding of a discord account", scope: ScopeUsersRead, tag: "users", response: []Binding{}, legacyResponse: []legacyBinding{}},
+	{method: http.MethodGet, path: "/users/xuid/:xuid/history", summary: "List every binding of a minecraft account", scope: ScopeUsersRead, tag: "users", response: []Binding{}, legacyResponse: []legacyBinding{}},
+}
+
+// apiOperations returns every route served by GetHttpHandler apart from the
+// documentation itself.
+func apiOperations() []apiOperation {
+	ops := []apiOperation{
+		{method: http.MethodGet, path: "/test", summary: "Check that the server is reachable and the token is valid", tag: "health"},
+		{method: http.MethodPost, path: "/v1/codes/issue", summary: "Issue a code for a minecraft account", scope: ScopeCodesIssue, tag: "codes", request: IssueCodeRequest{}, response: CodeInformation{}},
+		{method: http.MethodPost, path: "/v1/codes/check", summary: "Get the information of a code", scope: ScopeCodesRead, tag: "codes", request: CheckCodeRequest{}, response: CodeInformation{}},
+		{method: http.MethodPost, path: "/v1/codes/revoke", summary: "Revoke a code", scope: ScopeCodesRevoke, tag: "codes", request: CodeRequest{}},
+		{method: http.MethodPut, path: "/v1/users/xuid/:xuid/gamertag", summary: "Update the gamertag of a bound minecraft account", scope: ScopeUsersWrite, tag: "users", request: UpdateGamertagRequest{}, response: User{}},
+		{method: http.MethodGet, path: "/v1/tokens", summary: "List the API tokens", scope: ScopeTokensManage, tag: "tokens", response: []APIToken{}},
+		{method: http.MethodPost, path: "/v1/tokens", summary: "Create an API token, the secret is only returned once", scope: ScopeTokensManage, tag: "tokens", request: CreateTokenRequest{}, response: CreatedToken{}},
+		{method: http.MethodDelete, path: "/v1/tokens/:name", summary: "Delete an API token", scope: ScopeTokensManage, tag: "tokens"},
+		{method: http.MethodPost, path: "/codes/issue", summary: "Issue a code, the gamertag is passed as query parameter", scope: ScopeCodesIssue, tag: "legacy", rawRequest: "XUID", query: []string{"gamertag"}, response: legacyCodeInformation{}, deprecated: true},
+		{method: http.MethodPost, path: "/codes/check", summary: "Get the information of a code, the expected XUID may be passed as query parameter", scope: ScopeCodesRead, tag: "legacy", rawRequest: "code", query: []string{"xuid"}, response: legacyCodeInformation{}, deprecated: true},
+		{method: http.MethodPost, path: "/codes/revoke", summary: "Revoke a code", scope: ScopeCodesRevoke, tag: "legacy", rawRequest: "code", deprecated: true},
+		{method: http.MethodPut, path: "/users/xuid/:xuid/gamertag", summary: "Update the gamertag of a bound minecraft account", scope: ScopeUsersWrite, tag: "legacy", rawRequest: "gamertag", response: legacyUser{}, deprecated: true},
+	}
+	for _, op := range userOperations {
+		v1 := op
+		v1.path = "/v1" + op.path
+		legacy := op
+		legacy.tag = "legacy"
+		legacy.response = op.legacyResponse
+		legacy.deprecated = true
+		ops = append(ops, v1, legacy)
+	}
+	return ops
+}
+
+// openAPIDocument builds the OpenAPI 3 document of the given operations. The
+// schemas are derived from the request and payload types.
+func openAPIDocument(ops []apiOperation) map[string]interface{} {
+	schemas := map[string]interface{}{}
+	schemaOf(reflect.TypeOf(ErrorInformation{}), schemas)
+	schemaOf(reflect.TypeOf(legacyErrorInformation{}), schemas)
+	schemas["Payload"] = map[string]interface{}{
+		"type":     "object",
+		"required": []string{"error", "data"},
+		"properties": map[string]interface{}{
+			"error": map[string]interface{}{
+				"allOf":    []interface{}{schemaRef("ErrorInformation")},
+				"nullable": true,
+			},
+			"data": map[string]interface{}{"nullable": true},
+		},
+	}
+
+	paths := map[string]map[string]interface{}{}
+	for _, op := range ops {
+		path, params := openAPIPath(op.path)
+		for _, name := range op.query {
+			params = append(params, map[string]interface{}{
+				"name":   name,
+				"in":     "query",
+				"schema": map[string]interface{}{"type": "string"},
+			})
+		}
+		if paths[path] == nil {
+			paths[path] = map[string]interface{}{}
+		}
+		errorResponse := "#/components/responses/Error"
+		if op.deprecated {
+			// Legacy routes keep their untagged error fields.
+			errorResponse = "#/components/responses/LegacyError"
+		}
+		operation := map[string]interface{}{
+			"summary":     op.summary,
+			"tags":        []string{op.tag},
+			"operationId": operationId(op),
+			"responses": map[string]interface{}{
+				"200": map[string]interface{}{
+					"description": "Success",
+					"content":     jsonContent(payloadSchema(op.response, schemas)),
+				},
+				"default": map[string]interface{}{"$ref": errorResponse},
+			},
+		}
+
+		if len(params) > 0 {
+			operation["parameters"] = params
+		}
+		if op.request != nil {
+			operation["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content":  jsonContent(schemaOf(reflect.TypeOf(op.request), schemas)),
+			}
+		} else if op.rawRequest != "" {
+			operation["requestBody"] = map[string]interface{}{
+				"required":    true,
+				"description": "The " + op.rawRequest + " as plain text",
+				"content": map[string]interface{}{
+					"text/plain": map[string]interface{}{
+						"schema": map[string]interface{}{"type": "string"},
+					},
+				},
+			}
+		}
+		if op.deprecated {
+			operation["deprecated"] = true
+		}
+		if op.scope != "" {
+			operation["description"] = "Requires the " + op.scope + " scope."
+			operation["x-required-scope"] = op.scope
+		}
+		paths[path][strings.ToLower(op.method)] = operation
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "go-df-discord",
+			"description": "Binds minecraft accounts of Dragonfly servers to discord accounts.",
+			"version":     "1",
+		},
+		"paths": paths,
+		"security": []interface{}{
+			map[string]interface{}{"bearerToken": []string{}},
+			map[string]interface{}{"signature": []string{}},
+		},
+		"components": map[string]interface{}{
+			"schemas": schemas,
+			"responses": map[string]interface{}{
+				"Error": map[string]interface{}{
+					"description": "Failure, the status is the first three digits of error.code",
+					"content": jsonContent(map[string]interface{}{
+						"allOf": []interface{}{
+							schemaRef("Payload"),
+							map[string]interface{}{
+								"properties": map[string]interface{}{
+									"error": schemaRef("ErrorInformation"),
+								},
+							},
+						},
+					}),
+				},
+				"LegacyError": map[string]interface{}{
+					"description": "Failure of a legacy route, the status is the first three digits of error.Code",
+					"content": jsonContent(map[string]interface{}{
+						"allOf": []interface{}{
+							schemaRef("Payload"),
+							map[string]interface{}{
+								"properties": map[string]interface{}{
+									"error": schemaRef("legacyErrorInformation"),
+								},
+							},
+						},
+					}),
+				},
+			},
+			"securitySchemes": map[string]interface{}{
+				"bearerToken": map[string]interface{}{
+					"type":   "http",
+					"scheme": "bearer",
+				},
+				"signature": map[string]interface{}{
+					"type":        "apiKey",
+					"in":          "header",
+					"name":        HeaderSignature,
+					"description": "Used instead of tokens when the server has a signing secret. Hex encoded HMAC-SHA256 of the method, request URI, " + HeaderTimestamp + ", " + HeaderNonce + " and the SHA-256 of the body, separated by newlines.",
+				},
+			},
+		},
+	}
+}
+
+// openAPIPath converts gin path parameters such as :xuid to {xuid}.
+func openAPIPath(path string) (string, []interface{}) {
+	var params []interface{}
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		name, ok := strings.CutPrefix(segment, ":")
+		if !ok {
+			continue
+		}
+		segments[i] = "{" + name + "}"
+		params = append(params, map[string]interface{}{
+			"name":     name,
+			"in":       "path",
+			"required": true,
+			"schema":   map[string]interface{}{"type": "string"},
+		})
+	}
+	return strings.Join(segments, "/"), params
+}
+
+func operationId(op apiOperation) string {
+	id := strings.ToLower(op.method)
+	for _, segment := range strings.Split(op.path, "/") {
+		segment = strings.TrimPrefix(segment, ":")
+		for _, word := range strings.Split(segment, "-") {
+			if word != "" {
+				id += strings.ToUpper(word[:1]) + word[1:]
+			}
+		}
+	}
+	return id
+}
+
+func payloadSchema(data interface{}, schemas map[string]interface{}) map[string]interface{} {
+	if data == nil {
+		return schemaRef("Payload")
+	}
+	return map[string]interface{}{
+		"allOf": []interface{}{
+			schemaRef("Payload"),
+			map[string]interface{}{
+				"properties": map[string]interface{}{
+					"data": schemaOf(reflect.TypeOf(data), schemas),
+				},
+			},
+		},
+	}
+}
+
+// schemaOf returns the schema of t, adding named structs to schemas and
+// referencing them.
+func schemaOf(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	if t == reflect.TypeOf(time.Time{}) {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		schema := schemaOf(t.Elem(), schemas)
+		if _, isRef := schema["$ref"]; isRef {
+			return map[string]interface{}{"allOf": []interface{}{schema}, "nullable": true}
+		}
+		schema["nullable"] = true
+		return schema
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schemaOf(t.Elem(), schemas)}
+	case reflect.Struct:
+		if _, exists := schemas[t.Name()]; !exists {
+			schemas[t.Name()] = struct{}{}
+			schemas[t.Name()] = structSchema(t, schemas)
+		}
+		return schemaRef(t.Name())
+	}
+	return map[string]interface{}{}
+}
+
+func structSchema(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	properties := map[string]interface{}{}
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		schema := schemaOf(field.Type, schemas)
+		for _, rule := range strings.Split(field.Tag.Get("binding"), ",") {
+			switch rule {
+			case "required":
+				required = append(required, name)
+			case "numeric":
+				schema["pattern"] = "^[0-9]+$"
+			case "alphanum":
+				schema["pattern"] = "^[a-zA-Z0-9]+$"
+			}
+		}
+		properties[name] = schema
+	}
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func schemaRef(name string) map[string]interface{} {
+	return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+}
+
+func jsonContent(schema map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"application/json": map[string]interface{}{"schema": schema},
+	}
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestOpenAPIDocumentsEveryRoute keeps the document from silently falling
+// behind the router, and the other way around.
+func TestOpenAPIDocumentsEveryRoute(t *testing.T) {
+	_, handler := newTestServer(t)
+	routed := map[string]bool{}
+	for _, route := range handler.(*gin.Engine).Routes() {
+		if route.Path == "/openapi.json" || strings.HasPrefix(route.Path, "/docs") {
+			continue
+		}
+		routed[route.Method+" "+route.Path] = true
+	}
+	documented := map[string]bool{}
+	for _, op := range apiOperations() {
+		documented[op.method+" "+op.path] = true
+	}
+	for route := range routed {
+		if !documented[route] {
+			t.Errorf("route %s is missing from the OpenAPI document", route)
+		}
+	}
+	for op := range documented {
+		if !routed[op] {
+			t.Errorf("documented operation %s has no route", op)
+		}
+	}
+}
+
+func TestOpenAPIDocumentsLegacyTypes(t *testing.T) {
+	for _, op := range apiOperations() {
+		if op.tag != "legacy" || op.response == nil {
+			continue
+		}
+		typ := reflect.TypeOf(op.response)
+		if typ.Kind() == reflect.Slice {
+			typ = typ.Elem()
+		}
+		if !strings.HasPrefix(typ.Name(), "legacy") {
+			t.Errorf("%s %s documents %s instead of a legacy type", op.method, op.path, typ)
+		}
+	}
+}
+
+func TestDocsServeEmbeddedAssets(t *testing.T) {
+	_, handler := newTestServer(t)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /docs: status %d", rec.Code)
+	}
+	if strings.Contains(rec.Body.String(), "https://") {
+		t.Fatal("docs page loads external resources")
+	}
+	for _, asset := range []string{"swagger-ui.css", "swagger-ui-bundle.js"} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/docs/assets/"+asset, nil))
+		if rec.Code != http.StatusOK || rec.Body.Len() == 0 {
+			t.Errorf("GET /docs/assets/%s: status %d, %d bytes", asset, rec.Code, rec.Body.Len())
+		}
+	}
+}
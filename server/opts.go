@@ -1,15 +1,76 @@
 package server
 
 import (
+    "errors"
     "github.com/Gewinum/go-df-discord/utils"
     "log/slog"
     "os"
+    "time"
 )
 
 type Opts struct {
     Logger  *slog.Logger
     Repo    Repository
+    // Database configures the default repository. It is ignored when Repo is set.
+    // Leaving both unset opens test.db in the working directory, which is
+    // deprecated.
+    Database *DatabaseConfig
     CodeStr CodeStore
+    // CodeTTL is how long an issued code stays valid. Defaults to 15 minutes.
+    CodeTTL time.Duration
+    // PersistCodes stores codes in the database of the default repository
+    // instead of memory. It is ignored when CodeStr is set.
+    PersistCodes bool
+    // TokenStr keeps the named API tokens. Defaults to the database of the
+    // default repository, or memory when Repo is set.
+    TokenStr TokenStore
+    // SigningSecret switches authentication from tokens to HMAC signed
+    // requests, see Signature. Signed requests have every scope.
+    SigningSecret []byte
+    // SignatureMaxSkew is how far the timestamp of a signed request may be
+    // off. Defaults to 5 minutes.
+    SignatureMaxSkew time.Duration
+    // NonceCache remembers nonces of signed requests. Defaults to memory, use
+    // NewRedisNonceCache when running several instances.
+    NonceCache NonceCache
+    // GuildID is the guild in which the bot manages member roles.
+    GuildID string
+    // BindRoles are role IDs granted to members once they bind and revoked
+    // once they unbind. Requires GuildID.
+    BindRoles []string
+    // RoleAttempts is how many times a failed role or nickname update is
+    // tried. Defaults to 3.
+    RoleAttempts int
+    // NicknameTemplate sets the guild nickname of bound members, for example
+    // "{gamertag} | {discord}". Nicknames are left alone when empty. Requires GuildID.
+    NicknameTemplate string
+    // StaffRole is the role ID allowed to use /whois. When empty, /whois
+    // defaults to members with the Moderate Members permission.
+    StaffRole string
+    // AdminRole is the role ID required for /admin on top of the command's
+    // default Manage Server permission.
+    AdminRole string
+    // AuditChannelID is the channel /admin actions are reported to. Actions
+    // are only logged when empty.
+    AuditChannelID string
+    // BindAttempts is how many wrong codes a member may enter in /bind before
+    // being locked out. Defaults to 5, negative disables the limit.
+    BindAttempts int
+    // CodeAttempts is how many wrong codes an API token may check or revoke
+    // before being locked out. Defaults to 20, negative disables the limit.
+    CodeAttempts int
+    // AttemptLockout is the first lockout, every further wrong code doubles it
+    // up to MaxAttemptLockout. Defaults to 1 minute and 1 hour.
+    AttemptLockout    time.Duration
+    MaxAttemptLockout time.Duration
+    // CodeGuessLimit revokes the outstanding code of an account once this many
+    // wrong codes were checked for it, so the player has to request a new one.
+    // Only check requests that name the XUID count, see CheckCodeRequest.
+    // Counted per instance, zero disables it.
+    CodeGuessLimit int
+    // BindConfirmTimeout is how long /bind waits for the member to confirm the
+    // minecraft account. Defaults to 2 minutes.
+    BindConfirmTimeout time.Duration
 }
 
 func FillEmptyOpts(opts *Opts) {
@@ -18,13 +79,71 @@ func FillEmptyOpts(opts *Opts) {
     }
 
     if opts.Repo == nil {
-        repo, err := NewDefaultRepository()
+        if opts.Database == nil {
+            // Older setups relied on test.db being opened, keep it until
+            // they set Database.
+            opts.Logger.Warn("No database configured, falling back to test.db in the working directory; this is deprecated, set Opts.Database")
+            opts.Database = &DatabaseConfig{Driver: DriverSQLite, DSN: "test.db"}
+        }
+        repo, err := NewRepository(*opts.Database)
         utils.ErrorPanic(err)
         opts.Repo = repo
     }
 
+    if opts.RoleAttempts <= 0 {
+        opts.RoleAttempts = 3
+    }
+
+    if opts.BindAttempts == 0 {
+        opts.BindAttempts = 5
+    }
+
+    if opts.CodeAttempts == 0 {
+        opts.CodeAttempts = 20
+    }
+
+    if opts.AttemptLockout <= 0 {
+        opts.AttemptLockout = time.Minute
+    }
+
+    if opts.MaxAttemptLockout <= 0 {
+        opts.MaxAttemptLockout = time.Hour
+    }
+
+    if opts.BindConfirmTimeout <= 0 {
+        opts.BindConfirmTimeout = 2 * time.Minute
+    }
+
+    if opts.SignatureMaxSkew <= 0 {
+        opts.SignatureMaxSkew = 5 * time.Minute
+    }
+
+    if opts.NonceCache == nil && opts.SigningSecret != nil {
+        opts.NonceCache = newDefaultNonceCache()
+    }
+
+    if opts.CodeTTL <= 0 {
+        opts.CodeTTL = defaultCodeTTL
+    }
+
+    if opts.CodeStr == nil && opts.PersistCodes {
+        repo, ok := opts.Repo.(*defaultRepository)
+        if !ok {
+            panic(errors.New("PersistCodes requires the default repository"))
+        }
+        opts.CodeStr = NewSQLCodeStore(repo.db, opts.CodeTTL)
+    }
+
     if opts.CodeStr == nil {
-        opts.CodeStr = newDefaultCodeStore()
+        opts.CodeStr = newDefaultCodeStore(opts.CodeTTL)
+    }
+
+    if opts.TokenStr == nil {
+        if repo, ok := opts.Repo.(*defaultRepository); ok {
+            opts.TokenStr = NewSQLTokenStore(repo.db)
+        } else {
+            opts.TokenStr = newDefaultTokenStore()
+        }
     }
 }
 
@@ -0,0 +1,158 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"slices"
+	"time"
+)
+
+const redisKeyPrefix = "dfdiscord:"
+
+type redisCodeStore struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+// NewRedisCodeStore returns a CodeStore that keeps codes in Redis, so several
+// server instances can share them. Expiry is handled by Redis key TTLs, so
+// the store doesn't report CodeExpired. A ttl that isn't positive means 15
+// minutes, a zero TTL would create keys that never expire.
+func NewRedisCodeStore(client *redis.Client, ttl time.Duration) CodeStore {
+	if ttl <= 0 {
+		ttl = defaultCodeTTL
+	}
+	return &redisCodeStore{
+		client: client,
+		ttl:    ttl,
+	}
+}
+
+func (s *redisCodeStore) GetInformation(code string) (*CodeInformation, error) {
+	raw, err := s.client.Get(context.Background(), codeKey(code)).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, NewApplicationError(ErrorCodeCodeNotFound, "Code doesn't exist")
+		}
+		return nil, err
+	}
+	var info CodeInformation
+	err = json.Unmarshal(raw, &info)
+	if err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+func (s *redisCodeStore) GetForXuid(xuid string) (*CodeInformation, error) {
+	code, err := s.client.Get(context.Background(), xuidKey(xuid)).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, NewApplicationError(ErrorCodeNoCodeForXUID, "There is no code for this XUID")
+		}
+		return nil, err
+	}
+	info, err := s.GetInformation(code)
+	if err != nil {
+		var appError ApplicationError
+		if errors.As(err, &appError) {
+			return nil, NewApplicationError(ErrorCodeNoCodeForXUID, "There is no code for this XUID")
+		}
+		return nil, err
+	}
+	return info, nil
+}
+
+func (s *redisCodeStore) Issue(xuid, gamertag string) (*CodeInformation, error) {
+	ctx := context.Background()
+	existing, _ := s.GetForXuid(xuid)
+	if existing != nil {
+		return nil, NewApplicationErrorf(ErrorCodeCodeAlreadyIssued, "Code %s is already issued", existing.Code)
+	}
+	now := time.Now()
+	info := &CodeInformation{
+		XUID:     xuid,
+		Gamertag: gamertag,
+		Issued:   now,
+		Expires:  now.Add(s.ttl),
+	}
+	for {
+		generated, err := generateCode(6)
+		if err != nil {
+			return nil, err
+		}
+		info.Code = generated
+		raw, err := json.Marshal(info)
+		if err != nil {
+			return nil, err
+		}
+		ok, err := s.client.SetNX(ctx, codeKey(generated), raw, s.ttl).Result()
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			break
+		}
+	}
+	// The secondary index is claimed with SETNX as well, so two nodes issuing
+	// for the same XUID at once end up with a single code.
+	ok, err := s.client.SetNX(ctx, xuidKey(xuid), info.Code, s.ttl).Result()
+	if err != nil || !ok {
+		s.client.Del(ctx, codeKey(info.Code))
+		if err != nil {
+			return nil, err
+		}
+		winner, err := s.client.Get(ctx, xuidKey(xuid)).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return nil, err
+		}
+		return nil, NewApplicationErrorf(ErrorCodeCodeAlreadyIssued, "Code %s is already issued", winner)
+	}
+	return info, nil
+}
+
+func (s *redisCodeStore) Revoke(code string) error {
+	info, err := s.GetInformation(code)
+	if err != nil {
+		return err
+	}
+	return s.client.Del(context.Background(), codeKey(info.Code), xuidKey(info.XUID)).Err()
+}
+
+// List scans the code keys, which is fine for the few codes that are
+// outstanding at any time.
+func (s *redisCodeStore) List() ([]*CodeInformation, error) {
+	ctx := context.Background()
+	var codes []*CodeInformation
+	iter := s.client.Scan(ctx, 0, codeKey("*"), 100).Iterator()
+	for iter.Next(ctx) {
+		raw, err := s.client.Get(ctx, iter.Val()).Bytes()
+		if err != nil {
+			if errors.Is(err, redis.Nil) {
+				continue
+			}
+			return nil, err
+		}
+		var info CodeInformation
+		err = json.Unmarshal(raw, &info)
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, &info)
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	slices.SortFunc(codes, compareIssued)
+	return codes, nil
+}
+
+func codeKey(code string) string {
+	return redisKeyPrefix + "code:" + code
+}
+
+func xuidKey(xuid string) string {
+	return redisKeyPrefix + "xuid:" + xuid
+}
@@ -0,0 +1,149 @@
+package server
+
+import (
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestRedisCodeStore(t *testing.T) (*miniredis.Miniredis, CodeStore) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return mr, NewRedisCodeStore(client, time.Minute)
+}
+
+func TestRedisCodeStoreIssue(t *testing.T) {
+	_, store := newTestRedisCodeStore(t)
+	info, err := store.Issue("1000", "Steve")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := store.GetInformation(info.Code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.XUID != "1000" || got.Gamertag != "Steve" {
+		t.Fatalf("GetInformation = %+v", got)
+	}
+	got, err = store.GetForXuid("1000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Code != info.Code {
+		t.Fatalf("GetForXuid returned %s, want %s", got.Code, info.Code)
+	}
+	_, err = store.Issue("1000", "Steve")
+	if errorCode(err) != ErrorCodeCodeAlreadyIssued {
+		t.Fatalf("second Issue: %v", err)
+	}
+}
+
+func TestRedisCodeStoreExpiry(t *testing.T) {
+	mr, store := newTestRedisCodeStore(t)
+	info, err := store.Issue("1000", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mr.FastForward(time.Minute + time.Second)
+	if _, err := store.GetInformation(info.Code); errorCode(err) != ErrorCodeCodeNotFound {
+		t.Fatalf("GetInformation after TTL: %v", err)
+	}
+	if _, err := store.GetForXuid("1000"); errorCode(err) != ErrorCodeNoCodeForXUID {
+		t.Fatalf("GetForXuid after TTL: %v", err)
+	}
+	if _, err := store.Issue("1000", ""); err != nil {
+		t.Fatalf("Issue after TTL: %v", err)
+	}
+}
+
+func TestRedisCodeStoreRevoke(t *testing.T) {
+	mr, store := newTestRedisCodeStore(t)
+	info, err := store.Issue("1000", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Revoke(info.Code); err != nil {
+		t.Fatal(err)
+	}
+	if mr.Exists(codeKey(info.Code)) || mr.Exists(xuidKey("1000")) {
+		t.Fatal("Revoke left keys behind")
+	}
+	if err := store.Revoke(info.Code); errorCode(err) != ErrorCodeCodeNotFound {
+		t.Fatalf("second Revoke: %v", err)
+	}
+	codes, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != 0 {
+		t.Fatalf("List returned %d codes after Revoke", len(codes))
+	}
+}
+
+func TestRedisCodeStoreConcurrentIssue(t *testing.T) {
+	mr, store := newTestRedisCodeStore(t)
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		issued []*CodeInformation
+		lost   []error
+	)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			info, err := store.Issue("1000", "")
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				issued = append(issued, info)
+			case errorCode(err) == ErrorCodeCodeAlreadyIssued:
+				lost = append(lost, err)
+			default:
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if len(issued) != 1 || len(lost) != 49 {
+		t.Fatalf("issued %d codes and rejected %d, want 1 and 49", len(issued), len(lost))
+	}
+	for _, err := range lost {
+		if !strings.Contains(err.Error(), issued[0].Code) {
+			t.Fatalf("rejection %q doesn't name the issued code %s", err, issued[0].Code)
+		}
+	}
+	indexed, err := mr.Get(xuidKey("1000"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if indexed != issued[0].Code {
+		t.Fatalf("XUID index points to %s, want %s", indexed, issued[0].Code)
+	}
+	// Losers must not leave their code keys behind.
+	if keys := mr.Keys(); len(keys) != 2 {
+		t.Fatalf("keys after concurrent Issue: %v", keys)
+	}
+}
+
+func TestRedisCodeStoreDefaultTTL(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	store := NewRedisCodeStore(client, 0)
+	info, err := store.Issue("1000", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{codeKey(info.Code), xuidKey("1000")} {
+		if ttl := mr.TTL(key); ttl != defaultCodeTTL {
+			t.Fatalf("%s expires in %s, want %s", key, ttl, defaultCodeTTL)
+		}
+	}
+}
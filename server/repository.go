@@ -2,48 +2,92 @@ package server
 
 import (
 	"errors"
-	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+	"time"
 )
 
 type User struct {
-	Discord string
-	XUID    string
+	Discord  string `json:"discord"`
+	XUID     string `json:"xuid"`
+	Gamertag string `json:"gamertag"`
+}
+
+// Binding is a current or past link between a discord and minecraft account.
+// Unbound is nil while the binding is still active.
+type Binding struct {
+	Discord string     `json:"discord"`
+	XUID    string     `json:"xuid"`
+	Bound   time.Time  `json:"bound"`
+	Unbound *time.Time `json:"unbound"`
 }
 
 type Repository interface {
 	GetUserByDiscord(discordId string) (*User, error)
 	GetUserByXUID(xuid string) (*User, error)
-	CreateUser(discordId, xuid string) (*User, error)
+	// GetUserByGamertag matches the gamertag case-insensitively.
+	GetUserByGamertag(gamertag string) (*User, error)
+	CreateUser(discordId, xuid, gamertag string) (*User, error)
+	// UpdateGamertag returns an ErrorCodeUserNotFound ApplicationError if the
+	// XUID isn't bound.
+	UpdateGamertag(xuid, gamertag string) error
 	DeleteUserByDiscord(discordId string) error
 	DeleteUserByXUID(xuid string) error
+	// BindingHistoryByDiscord and BindingHistoryByXUID list every binding of the
+	// account, including removed ones, newest first.
+	BindingHistoryByDiscord(discordId string) ([]*Binding, error)
+	BindingHistoryByXUID(xuid string) ([]*Binding, error)
+	// ListUsers returns active bindings ordered by creation, limit at a time.
+	ListUsers(offset, limit int) ([]*User, error)
 }
 
 type UserData struct {
 	*gorm.Model
-	Discord string
-	XUID    string `gorm:"column:xuid"`
+	Discord  string
+	XUID     string `gorm:"column:xuid"`
+	Gamertag string
 }
 
 func (u *UserData) ToUser() *User {
 	return &User{
+		Discord:  u.Discord,
+		XUID:     u.XUID,
+		Gamertag: u.Gamertag,
+	}
+}
+
+func (u *UserData) ToBinding() *Binding {
+	binding := &Binding{
 		Discord: u.Discord,
 		XUID:    u.XUID,
+		Bound:   u.CreatedAt,
+	}
+	if u.DeletedAt.Valid {
+		binding.Unbound = &u.DeletedAt.Time
 	}
+	return binding
 }
 
 type defaultRepository struct {
 	db *gorm.DB
 }
 
+// NewDefaultRepository opens test.db in the working directory.
+//
+// Deprecated: use NewRepository with an explicit DatabaseConfig.
 func NewDefaultRepository() (Repository, error) {
-	db, err := gorm.Open(sqlite.Open("test.db"), &gorm.Config{})
+	return NewRepository(DatabaseConfig{Driver: DriverSQLite, DSN: "test.db"})
+}
+
+func NewRepository(cfg DatabaseConfig) (Repository, error) {
+	db, err := OpenDatabase(cfg)
 	if err != nil {
 		return nil, err
 	}
-	err = db.AutoMigrate(&UserData{})
-	if err != nil {
-		return nil, err
+	if !cfg.SkipMigrations {
+		err = MigrateUp(db)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return &defaultRepository{
@@ -56,7 +100,7 @@ func (r *defaultRepository) GetUserByDiscord(discordId string) (*User, error) {
 	err := r.db.First(&user, "discord = ?", discordId).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, NewApplicationError(40400, "User not found")
+			return nil, NewApplicationError(ErrorCodeUserNotFound, "User not found")
 		}
 		return nil, err
 	}
@@ -68,48 +112,109 @@ func (r *defaultRepository) GetUserByXUID(xuid string) (*User, error) {
 	err := r.db.First(&user, "xuid = ?", xuid).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, NewApplicationError(40400, "User not found")
+			return nil, NewApplicationError(ErrorCodeUserNotFound, "User not found")
 		}
 		return nil, err
 	}
 	return user.ToUser(), nil
 }
 
-func (r *defaultRepository) CreateUser(discordId, xuid string) (*User, error) {
+func (r *defaultRepository) GetUserByGamertag(gamertag string) (*User, error) {
 	var user UserData
-	err := r.db.First(&user, "discord = ? OR xuid = ?", discordId, xuid).Error
-	if err == nil {
-		return nil, NewApplicationError(40000, "Either discord or XUID are already bound")
+	err := r.db.First(&user, "LOWER(gamertag) = LOWER(?)", gamertag).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewApplicationError(ErrorCodeUserNotFound, "User not found")
+		}
+		return nil, err
 	}
-	user.Discord = discordId
-	user.XUID = xuid
-	err = r.db.Create(&user).Error
+	return user.ToUser(), nil
+}
+
+func (r *defaultRepository) CreateUser(discordId, xuid, gamertag string) (*User, error) {
+	var user UserData
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.First(&user, "discord = ? OR xuid = ?", discordId, xuid).Error
+		if err == nil {
+			return NewApplicationError(ErrorCodeAlreadyBound, "Either discord or XUID are already bound")
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		user.Discord = discordId
+		user.XUID = xuid
+		user.Gamertag = gamertag
+		err = tx.Create(&user).Error
+		// The unique indexes catch bindings created concurrently after the
+		// lookup above.
+		if isDuplicateKeyError(tx, err) {
+			return NewApplicationError(ErrorCodeAlreadyBound, "Either discord or XUID are already bound")
+		}
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
 	return user.ToUser(), nil
 }
 
+func (r *defaultRepository) UpdateGamertag(xuid, gamertag string) error {
+	result := r.db.Model(&UserData{}).Where("xuid = ?", xuid).Update("gamertag", gamertag)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return NewApplicationError(ErrorCodeUserNotFound, "User not found")
+	}
+	return nil
+}
+
 func (r *defaultRepository) DeleteUserByDiscord(discordId string) error {
 	user, err := r.GetUserByDiscord(discordId)
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return NewApplicationError(40400, "User not found")
-		}
 		return err
 	}
-	r.db.Delete(&UserData{}, "discord = ?", user.Discord)
-	return nil
+	return r.db.Delete(&UserData{}, "discord = ?", user.Discord).Error
 }
 
 func (r *defaultRepository) DeleteUserByXUID(xuid string) error {
 	user, err := r.GetUserByXUID(xuid)
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return NewApplicationError(40400, "User not found")
-		}
 		return err
 	}
-	r.db.Delete(&UserData{}, "xuid = ?", user.XUID)
-	return nil
+	return r.db.Delete(&UserData{}, "xuid = ?", user.XUID).Error
+}
+
+func (r *defaultRepository) BindingHistoryByDiscord(discordId string) ([]*Binding, error) {
+	return r.bindingHistory("discord = ?", discordId)
+}
+
+func (r *defaultRepository) BindingHistoryByXUID(xuid string) ([]*Binding, error) {
+	return r.bindingHistory("xuid = ?", xuid)
+}
+
+func (r *defaultRepository) ListUsers(offset, limit int) ([]*User, error) {
+	var users []UserData
+	err := r.db.Order("id").Offset(offset).Limit(limit).Find(&users).Error
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*User, 0, len(users))
+	for _, user := range users {
+		result = append(result, user.ToUser())
+	}
+	return result, nil
+}
+
+func (r *defaultRepository) bindingHistory(query string, args ...interface{}) ([]*Binding, error) {
+	var users []UserData
+	err := r.db.Unscoped().Where(query, args...).Order("created_at DESC").Find(&users).Error
+	if err != nil {
+		return nil, err
+	}
+	bindings := make([]*Binding, 0, len(users))
+	for _, user := range users {
+		bindings = append(bindings, user.ToBinding())
+	}
+	return bindings, nil
 }
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRepositoryConcurrentCreateUser(t *testing.T) {
+	for name, accounts := range map[string]func(i int) (string, string){
+		"same xuid":    func(i int) (string, string) { return fmt.Sprint(i), "1000" },
+		"same discord": func(i int) (string, string) { return "1", fmt.Sprint(1000 + i) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			repo := newTestRepository(t)
+			var wg sync.WaitGroup
+			var created atomic.Int32
+			for i := 0; i < 50; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					discord, xuid := accounts(i)
+					_, err := repo.CreateUser(discord, xuid, "")
+					switch {
+					case err == nil:
+						created.Add(1)
+					case errorCode(err) != ErrorCodeAlreadyBound:
+						t.Errorf("unexpected error: %v", err)
+					}
+				}(i)
+			}
+			wg.Wait()
+			if created.Load() != 1 {
+				t.Fatalf("created %d users, want 1", created.Load())
+			}
+		})
+	}
+}
+
+func TestRepositoryUniqueIndexes(t *testing.T) {
+	repo := newTestRepository(t)
+	if _, err := repo.CreateUser("1", "1000", ""); err != nil {
+		t.Fatal(err)
+	}
+	// Insert directly, as a concurrent CreateUser that passed the lookup
+	// would, to check the indexes rather than the lookup.
+	db := repo.(*defaultRepository).db
+	for _, data := range []*UserData{
+		{Discord: "1", XUID: "2000"},
+		{Discord: "2", XUID: "1000"},
+	} {
+		err := db.Create(data).Error
+		if !isDuplicateKeyError(db, err) {
+			t.Fatalf("inserting %s/%s: got %v, want a duplicate key error", data.Discord, data.XUID, err)
+		}
+	}
+}
+
+func TestRepositoryRebindAfterUnbind(t *testing.T) {
+	repo := newTestRepository(t)
+	if _, err := repo.CreateUser("1", "1000", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.DeleteUserByDiscord("1"); err != nil {
+		t.Fatal(err)
+	}
+	// The unique indexes only cover active bindings, so the soft deleted row
+	// mustn't block binding the same accounts again.
+	if _, err := repo.CreateUser("1", "1000", ""); err != nil {
+		t.Fatalf("rebinding after unbind: %v", err)
+	}
+	history, err := repo.BindingHistoryByXUID("1000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 || history[0].Unbound != nil || history[1].Unbound == nil {
+		t.Fatalf("history = %+v, want the active binding followed by the removed one", history)
+	}
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"errors"
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	colorInfo    = 0x5865F2
+	colorSuccess = 0x57F287
+	colorDanger  = 0xED4245
+)
+
+// messageResponse and the other helpers below build ephemeral responses, so
+// only the invoking user sees the outcome of their command.
+func messageResponse(content string) *discordgo.InteractionResponseData {
+	return &discordgo.InteractionResponseData{
+		Content:    content,
+		Embeds:     []*discordgo.MessageEmbed{},
+		Components: []discordgo.MessageComponent{},
+		Flags:      discordgo.MessageFlagsEphemeral,
+	}
+}
+
+// errorResponse shows ApplicationError messages to the user and hides
+// everything else behind a generic message.
+func errorResponse(lang string, err error) *discordgo.InteractionResponseData {
+	var appError ApplicationError
+	if errors.As(err, &appError) {
+		return messageResponse(appError.LocalizedMessage(lang))
+	}
+	return messageResponse(tr(lang, "something_went_wrong"))
+}
+
+func userEmbedResponse(lang, title string, color int, user *User) *discordgo.InteractionResponseData {
+	return &discordgo.InteractionResponseData{
+		Embeds:          []*discordgo.MessageEmbed{userEmbed(lang, title, color, user)},
+		Components:      []discordgo.MessageComponent{},
+		AllowedMentions: &discordgo.MessageAllowedMentions{},
+		Flags:           discordgo.MessageFlagsEphemeral,
+	}
+}
+
+func userEmbed(lang, title string, color int, user *User) *discordgo.MessageEmbed {
+	gamertag := user.Gamertag
+	if gamertag == "" {
+		gamertag = tr(lang, "unknown")
+	}
+	return &discordgo.MessageEmbed{
+		Title: title,
+		Color: color,
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "Discord", Value: "<@" + user.Discord + ">", Inline: true},
+			{Name: "Gamertag", Value: gamertag, Inline: true},
+			{Name: "XUID", Value: user.XUID, Inline: true},
+		},
+	}
+}
+
+// updateResponse replaces the message the pressed component belongs to.
+func updateResponse(data *discordgo.InteractionResponseData) *discordgo.InteractionResponse {
+	return &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: data,
+	}
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"errors"
+	"github.com/bwmarrin/discordgo"
+	"time"
+)
+
+// ReconcileRoles grants the binding roles to every bound member, fixing
+// members whose role updates failed or happened while the bot was offline.
+func (b *Bot) ReconcileRoles() error {
+	const pageSize = 100
+	failed := 0
+	for offset := 0; ; offset += pageSize {
+		users, err := b.service.ListUsers(offset, pageSize)
+		if err != nil {
+			return err
+		}
+		for _, user := range users {
+			if !b.grantRoles(user.Discord) {
+				failed++
+			}
+		}
+		if len(users) < pageSize {
+			break
+		}
+	}
+	b.opts.Logger.Info("Role reconciliation finished", "failed", failed)
+	return nil
+}
+
+func (b *Bot) grantRoles(discordId string) bool {
+	ok := true
+	for _, roleId := range b.opts.BindRoles {
+		err := b.retryMemberUpdate(func() error {
+			return b.api.GuildMemberRoleAdd(b.opts.GuildID, discordId, roleId)
+		})
+		if err != nil {
+			b.opts.Logger.Error("Could not grant binding role", "discord", discordId, "role", roleId, "error", err)
+			ok = false
+		}
+	}
+	return ok
+}
+
+func (b *Bot) revokeRoles(discordId string) bool {
+	ok := true
+	for _, roleId := range b.opts.BindRoles {
+		err := b.retryMemberUpdate(func() error {
+			return b.api.GuildMemberRoleRemove(b.opts.GuildID, discordId, roleId)
+		})
+		if err != nil {
+			b.opts.Logger.Error("Could not revoke binding role", "discord", discordId, "role", roleId, "error", err)
+			ok = false
+		}
+	}
+	return ok
+}
+
+// retryMemberUpdate runs update up to Opts.RoleAttempts times with exponential
+// backoff. Members that left the guild are not retried.
+func (b *Bot) retryMemberUpdate(update func() error) error {
+	delay := time.Second
+	var err error
+	for attempt := 1; attempt <= b.opts.RoleAttempts; attempt++ {
+		err = update()
+		if err == nil || isUnknownMember(err) {
+			return nil
+		}
+		if attempt < b.opts.RoleAttempts {
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+	return err
+}
+
+func isUnknownMember(err error) bool {
+	var restErr *discordgo.RESTError
+	return errors.As(err, &restErr) && restErr.Message != nil && restErr.Message.Code == discordgo.ErrCodeUnknownMember
+}
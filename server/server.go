@@ -5,6 +5,7 @@ import (
 	"github.com/Gewinum/go-df-discord/utils"
 	"github.com/gin-gonic/gin"
 	sloggin "github.com/samber/slog-gin"
+	swaggerFiles "github.com/swaggo/files/v2"
 	"net/http"
 )
 
@@ -23,39 +24,52 @@ func SuccessPayload(data interface{}) Payload {
 func FailurePayload(err ApplicationError) Payload {
 	return Payload{
 		Error: &ErrorInformation{
-			Code:    err.ErrorCode,
+			Code:    err.Code(),
 			Message: err.Error(),
 		},
 		Data: nil,
 	}
 }
 
+// LocalizedFailurePayload is FailurePayload with the message translated to
+// the given language.
+func LocalizedFailurePayload(err ApplicationError, lang string) Payload {
+	payload := FailurePayload(err)
+	payload.Error.Message = err.LocalizedMessage(lang)
+	return payload
+}
+
 type ErrorInformation struct {
-	Code    int
-	Message string
+	Code    int    `json:"code"`
+	Message string `json:"message"`
 }
 
 type Server struct {
-	accessToken     string
+	// accessTokenHash is the hash of the root token, see hashToken.
+	accessTokenHash string
 	discordBotToken string
 	opts            *Opts
 	service         *Service
 	bot             *Bot
+	// codeAttempts limits wrong codes per API token.
+	codeAttempts *attemptLimiter
 }
 
 func NewServer(accessToken, discordBotToken string, opts *Opts) *Server {
 	FillEmptyOpts(opts)
-	service := NewService(opts.Repo, opts.CodeStr)
-	bot, err := NewBot(discordBotToken, service)
+	service := NewService(opts.Repo, opts.CodeStr, opts.Logger)
+	service.SetCodeGuessLimit(opts.CodeGuessLimit)
+	bot, err := NewBot(discordBotToken, service, opts)
 	if err != nil {
 		panic(err)
 	}
 	return &Server{
-		accessToken:     accessToken,
+		accessTokenHash: hashToken(accessToken),
 		discordBotToken: discordBotToken,
 		opts:            opts,
 		service:         service,
 		bot:             bot,
+		codeAttempts:    newAttemptLimiter(opts.CodeAttempts, opts.AttemptLockout, opts.MaxAttemptLockout),
 	}
 }
 
@@ -82,70 +96,34 @@ func (s *Server) GetHttpHandler(isDevelopment bool) (http.Handler, error) {
 
 	e.Use(sloggin.New(s.opts.Logger))
 	e.Use(s.recoveryMiddleware)
-	e.Use(s.authMiddleware)
-
-	e.GET("/test", func(c *gin.Context) {
-		c.String(http.StatusOK, "hello world!")
-	})
 
-	e.POST("/codes/issue", func(c *gin.Context) {
-		rawData, err := c.GetRawData()
-		utils.ErrorPanic(err)
-		xuid := string(rawData)
-		info, err := s.service.IssueCode(xuid)
-		utils.ErrorPanic(err)
-		c.JSON(http.StatusOK, SuccessPayload(info))
+	document := openAPIDocument(apiOperations())
+	e.GET("/openapi.json", func(c *gin.Context) {
+		c.JSON(http.StatusOK, document)
 	})
-
-	e.POST("/codes/check", func(c *gin.Context) {
-		rawData, err := c.GetRawData()
-		utils.ErrorPanic(err)
-		code := string(rawData)
-		info, err := s.service.CheckCode(code)
-		utils.ErrorPanic(err)
-		c.JSON(http.StatusOK, SuccessPayload(info))
-	})
-
-	e.POST("/codes/revoke", func(c *gin.Context) {
-		rawData, err := c.GetRawData()
-		utils.ErrorPanic(err)
-		code := string(rawData)
-		utils.ErrorPanic(s.service.RevokeCode(code))
-		c.JSON(http.StatusOK, SuccessPayload(nil))
-	})
-
-	e.GET("/users/discord/:id", func(c *gin.Context) {
-		discordId := c.Param("id")
-		if discordId == "" {
-			panic(NewApplicationError(40000, "Discord ID is not specified"))
-		}
-		user, err := s.service.GetUserByDiscord(discordId)
-		utils.ErrorPanic(err)
-		c.JSON(http.StatusOK, SuccessPayload(user))
+	e.GET("/docs", func(c *gin.Context) {
+		c.Data(http.StatusOK, "text/html; charset=utf-8", docsPage)
 	})
+	// The swagger-ui assets are embedded, so the docs neither depend on nor
+	// trust a CDN.
+	e.StaticFS("/docs/assets", http.FS(swaggerFiles.FS))
 
-	e.GET("/users/xuid/:xuid", func(c *gin.Context) {
-		xuid := c.Param("xuid")
-		if xuid == "" {
-			panic(NewApplicationError(40000, "XUID is not specified"))
-		}
-		user, err := s.service.GetUserByXUID(xuid)
-		utils.ErrorPanic(err)
-		c.JSON(http.StatusOK, SuccessPayload(user))
+	auth := s.authMiddleware
+	if s.opts.SigningSecret != nil {
+		auth = s.signatureMiddleware
+	}
+	api := e.Group("", auth)
+	api.GET("/test", func(c *gin.Context) {
+		c.String(http.StatusOK, "hello world!")
 	})
 
+	v1 := api.Group("/v1")
+	s.registerV1(v1)
+	s.registerTokens(v1.Group("/tokens", requireScope(ScopeTokensManage)))
+	s.registerLegacy(api.Group("", deprecated))
 	return e, nil
 }
 
-func (s *Server) authMiddleware(c *gin.Context) {
-	authHeader := c.GetHeader("Authorization")
-	if authHeader != s.accessToken {
-		c.AbortWithStatus(http.StatusUnauthorized)
-		return
-	}
-	c.Next()
-}
-
 func (s *Server) recoveryMiddleware(c *gin.Context) {
 	defer func() {
 		rawErr := recover()
@@ -166,7 +144,15 @@ func (s *Server) recoveryMiddleware(c *gin.Context) {
 		}
 
 		accordingErrorCode := utils.GetNumberFirstDigits(appError.ErrorCode, 3)
-		c.AbortWithStatusJSON(accordingErrorCode, FailurePayload(appError))
+		payload := FailurePayload(appError)
+		if header := c.GetHeader("Accept-Language"); header != "" {
+			payload = LocalizedFailurePayload(appError, acceptLanguage(header))
+		}
+		if c.GetBool(legacyContextKey) {
+			c.AbortWithStatusJSON(accordingErrorCode, legacyFailure(payload))
+			return
+		}
+		c.AbortWithStatusJSON(accordingErrorCode, payload)
 	}()
 	c.Next()
 }
@@ -1,39 +1,215 @@
 package server
 
+import (
+	"log/slog"
+	"sync"
+)
+
 type NewUserHandler func(user *User)
 
+// RemovedUserHandler is called with the binding that has just been removed.
+type RemovedUserHandler func(user *User)
+
 type Service struct {
-	repo     Repository
-	codeStr  CodeStore
-	handlers []NewUserHandler
+	repo    Repository
+	codeStr CodeStore
+	events  *eventBus
+	logger  *slog.Logger
+
+	guessMu    sync.Mutex
+	guessLimit int
+	// guesses counts the wrong codes checked for each XUID.
+	guesses map[string]*codeGuesses
+
+	// bindMu serializes code issuing and binding, so a code can't be redeemed
+	// twice or issued for an account that is being bound at the same moment.
+	bindMu sync.Mutex
 }
 
-func NewService(repo Repository, codeStr CodeStore) *Service {
-	return &Service{repo: repo, codeStr: codeStr}
+func NewService(repo Repository, codeStr CodeStore, logger *slog.Logger) *Service {
+	s := &Service{repo: repo, codeStr: codeStr, events: newEventBus(logger), logger: logger}
+	if expiring, ok := codeStr.(ExpiringCodeStore); ok {
+		expiring.SetExpiryHandler(func(info *CodeInformation) {
+			s.forgetGuesses(info.XUID)
+			s.events.publish(CodeExpired{Code: info})
+		})
+	}
+	return s
+}
+
+// Subscribe registers a handler for every event published by the service.
+// Handlers run synchronously, a panicking handler is logged and skipped.
+func (s *Service) Subscribe(handler EventHandler) *Subscription {
+	return s.events.subscribe(handler)
+}
+
+func (s *Service) Unsubscribe(sub *Subscription) {
+	s.events.unsubscribe(sub)
 }
 
 func (s *Service) AddHandler(handler NewUserHandler) {
-	s.handlers = append(s.handlers, handler)
+	On(s, func(event BindingCreated) {
+		handler(event.User)
+	})
+}
+
+func (s *Service) AddRemovedHandler(handler RemovedUserHandler) {
+	On(s, func(event BindingRemoved) {
+		handler(event.User)
+	})
 }
 
-func (s *Service) IssueCode(xuid string) (*CodeInformation, error) {
+func (s *Service) IssueCode(xuid, gamertag string) (*CodeInformation, error) {
+	info, err := s.issueCode(xuid, gamertag)
+	if err != nil {
+		return nil, err
+	}
+	s.events.publish(CodeIssued{Code: info})
+	return info, nil
+}
+
+func (s *Service) issueCode(xuid, gamertag string) (*CodeInformation, error) {
+	s.bindMu.Lock()
+	defer s.bindMu.Unlock()
 	existing, _ := s.repo.GetUserByXUID(xuid)
 	if existing != nil {
-		return nil, NewApplicationError(40000, "Minecraft account is already bound to ID "+existing.Discord)
+		return nil, NewApplicationErrorf(ErrorCodeAccountAlreadyBound, "Minecraft account is already bound to ID %s", existing.Discord)
 	}
-	return s.codeStr.Issue(xuid)
+	return s.codeStr.Issue(xuid, gamertag)
+}
+
+// SetCodeGuessLimit makes the service revoke the outstanding code of an
+// account once limit wrong codes were checked for it through CheckCodeFor.
+// Zero disables it.
+func (s *Service) SetCodeGuessLimit(limit int) {
+	s.guessMu.Lock()
+	defer s.guessMu.Unlock()
+	s.guessLimit = limit
 }
 
 func (s *Service) CheckCode(code string) (*CodeInformation, error) {
+	return s.codeStr.GetInformation(code)
+}
+
+// CheckCodeFor checks a code that should belong to the given XUID. Codes of
+// other accounts are reported as not found and every wrong code counts
+// towards the guess limit of the XUID. An empty xuid checks like CheckCode.
+func (s *Service) CheckCodeFor(code, xuid string) (*CodeInformation, error) {
+	if xuid == "" {
+		return s.CheckCode(code)
+	}
 	info, err := s.codeStr.GetInformation(code)
+	if err == nil && info.XUID != xuid {
+		err = NewApplicationError(ErrorCodeCodeNotFound, "Code doesn't exist")
+	}
 	if err != nil {
+		if isWrongCode(err) {
+			s.recordWrongGuess(xuid)
+		}
 		return nil, err
 	}
 	return info, nil
 }
 
+// ListCodes returns the codes that are waiting to be redeemed.
+func (s *Service) ListCodes() ([]*CodeInformation, error) {
+	return s.codeStr.List()
+}
+
 func (s *Service) RevokeCode(code string) error {
-	return s.codeStr.Revoke(code)
+	info, _ := s.codeStr.GetInformation(code)
+	err := s.codeStr.Revoke(code)
+	if err != nil {
+		return err
+	}
+	if info == nil {
+		info = &CodeInformation{Code: code}
+	}
+	s.forgetGuesses(info.XUID)
+	s.events.publish(CodeRevoked{Code: info})
+	return nil
+}
+
+// codeGuesses counts the wrong codes checked for an XUID while code was its
+// outstanding code.
+type codeGuesses struct {
+	code  string
+	count int
+}
+
+// recordWrongGuess counts a wrong code against the outstanding code of the
+// XUID and revokes it once it reached the guess limit.
+func (s *Service) recordWrongGuess(xuid string) {
+	s.guessMu.Lock()
+	limit := s.guessLimit
+	s.guessMu.Unlock()
+	if limit <= 0 {
+		return
+	}
+	info, err := s.codeStr.GetForXuid(xuid)
+	if err != nil {
+		// Without an outstanding code there is nothing to guess.
+		return
+	}
+
+	s.guessMu.Lock()
+	if s.guesses == nil {
+		s.guesses = make(map[string]*codeGuesses)
+	}
+	guesses := s.guesses[xuid]
+	if guesses == nil || guesses.code != info.Code {
+		guesses = &codeGuesses{code: info.Code}
+		s.guesses[xuid] = guesses
+	}
+	guesses.count++
+	exhausted := guesses.count >= limit
+	if exhausted {
+		delete(s.guesses, xuid)
+	}
+	s.guessMu.Unlock()
+	if !exhausted || s.codeStr.Revoke(info.Code) != nil {
+		return
+	}
+	s.logger.Warn("Code revoked after too many wrong guesses", "xuid", xuid, "guesses", limit)
+	s.events.publish(CodeRevoked{Code: info})
+}
+
+// forgetGuesses drops the count of an XUID whose code is gone.
+func (s *Service) forgetGuesses(xuid string) {
+	s.guessMu.Lock()
+	defer s.guessMu.Unlock()
+	delete(s.guesses, xuid)
+}
+
+// Bind redeems the code for the given discord account: it checks the code,
+// creates the binding and revokes the code as a single step.
+func (s *Service) Bind(code, discord string) (*User, error) {
+	user, info, revoked, err := s.bind(code, discord)
+	if err != nil {
+		return nil, err
+	}
+	// Events are published after bindMu is released, so handlers may call
+	// back into the service.
+	s.events.publish(BindingCreated{User: user})
+	if revoked {
+		s.forgetGuesses(info.XUID)
+		s.events.publish(CodeRevoked{Code: info})
+	}
+	return user, nil
+}
+
+func (s *Service) bind(code, discord string) (*User, *CodeInformation, bool, error) {
+	s.bindMu.Lock()
+	defer s.bindMu.Unlock()
+	info, err := s.codeStr.GetInformation(code)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	user, err := s.repo.CreateUser(discord, info.XUID, info.Gamertag)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	return user, info, s.codeStr.Revoke(info.Code) == nil, nil
 }
 
 func (s *Service) GetUserByXUID(xuid string) (*User, error) {
@@ -44,21 +220,73 @@ func (s *Service) GetUserByDiscord(discord string) (*User, error) {
 	return s.repo.GetUserByDiscord(discord)
 }
 
-func (s *Service) CreateUser(discord, xuid string) (*User, error) {
-	user, err := s.repo.CreateUser(discord, xuid)
+func (s *Service) GetUserByGamertag(gamertag string) (*User, error) {
+	return s.repo.GetUserByGamertag(gamertag)
+}
+
+func (s *Service) ListUsers(offset, limit int) ([]*User, error) {
+	return s.repo.ListUsers(offset, limit)
+}
+
+func (s *Service) BindingHistoryByDiscord(discord string) ([]*Binding, error) {
+	return s.repo.BindingHistoryByDiscord(discord)
+}
+
+func (s *Service) BindingHistoryByXUID(xuid string) ([]*Binding, error) {
+	return s.repo.BindingHistoryByXUID(xuid)
+}
+
+func (s *Service) CreateUser(discord, xuid, gamertag string) (*User, error) {
+	user, err := s.repo.CreateUser(discord, xuid, gamertag)
+	if err != nil {
+		return nil, err
+	}
+	s.events.publish(BindingCreated{User: user})
+	return user, nil
+}
+
+// UpdateGamertag stores the current gamertag of a bound account and publishes
+// GamertagChanged when it differs from the stored one.
+func (s *Service) UpdateGamertag(xuid, gamertag string) (*User, error) {
+	user, err := s.repo.GetUserByXUID(xuid)
 	if err != nil {
 		return nil, err
 	}
-	for _, handler := range s.handlers {
-		handler(user)
+	if user.Gamertag == gamertag {
+		return user, nil
+	}
+	err = s.repo.UpdateGamertag(xuid, gamertag)
+	if err != nil {
+		return nil, err
 	}
+	previous := user.Gamertag
+	user.Gamertag = gamertag
+	s.events.publish(GamertagChanged{User: user, Previous: previous})
 	return user, nil
 }
 
 func (s *Service) DeleteUserByDiscord(discord string) error {
-	return s.repo.DeleteUserByDiscord(discord)
+	user, err := s.repo.GetUserByDiscord(discord)
+	if err != nil {
+		return err
+	}
+	err = s.repo.DeleteUserByDiscord(discord)
+	if err != nil {
+		return err
+	}
+	s.events.publish(BindingRemoved{User: user})
+	return nil
 }
 
 func (s *Service) DeleteUserByXUID(xuid string) error {
-	return s.repo.DeleteUserByXUID(xuid)
+	user, err := s.repo.GetUserByXUID(xuid)
+	if err != nil {
+		return err
+	}
+	err = s.repo.DeleteUserByXUID(xuid)
+	if err != nil {
+		return err
+	}
+	s.events.publish(BindingRemoved{User: user})
+	return nil
 }
@@ -0,0 +1,187 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestRepository(t *testing.T) Repository {
+	t.Helper()
+	name := strings.ReplaceAll(t.Name(), "/", "_")
+	repo, err := NewRepository(DatabaseConfig{
+		Driver: DriverSQLite,
+		DSN:    "file:" + name + "?mode=memory&cache=shared",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
+
+func newTestService(t *testing.T) *Service {
+	t.Helper()
+	return NewService(newTestRepository(t), newDefaultCodeStore(time.Minute), slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+// errorCode returns the ApplicationError code of err, or 0.
+func errorCode(err error) int {
+	var appError ApplicationError
+	if errors.As(err, &appError) {
+		return appError.ErrorCode
+	}
+	return 0
+}
+
+func TestServiceConcurrentIssueCode(t *testing.T) {
+	s := newTestService(t)
+	var wg sync.WaitGroup
+	var issued atomic.Int32
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.IssueCode("1000", "Steve")
+			switch {
+			case err == nil:
+				issued.Add(1)
+			case errorCode(err) != ErrorCodeCodeAlreadyIssued:
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if issued.Load() != 1 {
+		t.Fatalf("issued %d codes for one XUID, want 1", issued.Load())
+	}
+}
+
+func TestServiceConcurrentBind(t *testing.T) {
+	s := newTestService(t)
+	info, err := s.IssueCode("1000", "Steve")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	var bound atomic.Int32
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(discord string) {
+			defer wg.Done()
+			_, err := s.Bind(info.Code, discord)
+			switch {
+			case err == nil:
+				bound.Add(1)
+			case errorCode(err) != ErrorCodeCodeNotFound:
+				t.Errorf("unexpected error: %v", err)
+			}
+		}(fmt.Sprint(i))
+	}
+	wg.Wait()
+	if bound.Load() != 1 {
+		t.Fatalf("code was redeemed %d times, want 1", bound.Load())
+	}
+	if _, err := s.CheckCode(info.Code); errorCode(err) != ErrorCodeCodeNotFound {
+		t.Fatalf("code still valid after binding: %v", err)
+	}
+}
+
+// TestServiceConcurrentOperations mixes every code operation on a few
+// accounts, mostly to give the race detector something to chew on.
+func TestServiceConcurrentOperations(t *testing.T) {
+	s := newTestService(t)
+	expected := map[int]bool{
+		ErrorCodeAlreadyBound:        true,
+		ErrorCodeAccountAlreadyBound: true,
+		ErrorCodeCodeAlreadyIssued:   true,
+		ErrorCodeCodeNotFound:        true,
+		ErrorCodeNoCodeForXUID:       true,
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 64; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			xuid := fmt.Sprint(2000 + i%4)
+			for j := 0; j < 20; j++ {
+				info, err := s.IssueCode(xuid, "")
+				if err != nil {
+					if !expected[errorCode(err)] {
+						t.Errorf("IssueCode: %v", err)
+					}
+					continue
+				}
+				if _, err := s.CheckCode(info.Code); err != nil && !expected[errorCode(err)] {
+					t.Errorf("CheckCode: %v", err)
+				}
+				if j%2 == 0 {
+					err = s.RevokeCode(info.Code)
+				} else {
+					_, err = s.Bind(info.Code, fmt.Sprintf("%d-%d", i, j))
+				}
+				if err != nil && !expected[errorCode(err)] {
+					t.Errorf("RevokeCode/Bind: %v", err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// Every account ends up bound at most once.
+	for i := 0; i < 4; i++ {
+		history, err := s.BindingHistoryByXUID(fmt.Sprint(2000 + i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		active := 0
+		for _, binding := range history {
+			if binding.Unbound == nil {
+				active++
+			}
+		}
+		if active > 1 {
+			t.Fatalf("XUID %d has %d active bindings", 2000+i, active)
+		}
+	}
+}
+
+func TestServiceGuessLimitPerXUID(t *testing.T) {
+	s := newTestService(t)
+	s.SetCodeGuessLimit(3)
+	target, err := s.IssueCode("1000", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := s.IssueCode("2000", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Requests that don't name an XUID, including admin revokes, don't count.
+	for i := 0; i < 10; i++ {
+		s.CheckCode("WRONG")
+		s.RevokeCode("WRONG")
+	}
+	if _, err := s.CheckCodeFor(target.Code, "1000"); err != nil {
+		t.Fatalf("code revoked by guesses that named no XUID: %v", err)
+	}
+
+	s.CheckCodeFor("WRONG", "1000")
+	s.CheckCodeFor("WRONG", "1000")
+	// A valid code of another account is a wrong guess as well.
+	if _, err := s.CheckCodeFor(other.Code, "1000"); errorCode(err) != ErrorCodeCodeNotFound {
+		t.Fatalf("code of another XUID: %v", err)
+	}
+	if _, err := s.CheckCode(target.Code); errorCode(err) != ErrorCodeCodeNotFound {
+		t.Fatalf("code still valid after reaching the guess limit: %v", err)
+	}
+	if _, err := s.CheckCode(other.Code); err != nil {
+		t.Fatalf("guesses for one XUID revoked the code of another: %v", err)
+	}
+}
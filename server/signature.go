@@ -0,0 +1,162 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	sloggin "github.com/samber/slog-gin"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Headers of signed requests.
+const (
+	HeaderTimestamp = "X-Timestamp"
+	HeaderNonce     = "X-Nonce"
+	HeaderSignature = "X-Signature"
+)
+
+// signedTokenName is the token name of requests authenticated by signature.
+const signedTokenName = "signed"
+
+// maxSignedBodySize limits the body read before the signature is verified.
+// API request bodies are a few hundred bytes at most.
+const maxSignedBodySize = 64 << 10
+
+// Signature returns the hex encoded HMAC-SHA256 of a request. The request URI
+// includes the query, the timestamp is in unix seconds.
+func Signature(secret []byte, method, requestURI string, body []byte, timestamp int64, nonce string) string {
+	bodyHash := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(method + "\n" + requestURI + "\n" + strconv.FormatInt(timestamp, 10) + "\n" + nonce + "\n"))
+	mac.Write([]byte(hex.EncodeToString(bodyHash[:])))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// NonceCache remembers the nonces of signed requests, so they can't be
+// replayed while their timestamp is still accepted.
+type NonceCache interface {
+	// Use records the nonce until expires and reports whether it was unused.
+	Use(nonce string, expires time.Time) (bool, error)
+}
+
+type defaultNonceCache struct {
+	mu     sync.Mutex
+	nonces map[string]time.Time
+}
+
+func newDefaultNonceCache() NonceCache {
+	c := &defaultNonceCache{nonces: make(map[string]time.Time)}
+	go c.sweep(time.Minute)
+	return c
+}
+
+func (c *defaultNonceCache) Use(nonce string, expires time.Time) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, used := c.nonces[nonce]; used {
+		return false, nil
+	}
+	c.nonces[nonce] = expires
+	return true, nil
+}
+
+func (c *defaultNonceCache) sweep(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		c.mu.Lock()
+		for nonce, expires := range c.nonces {
+			if now.After(expires) {
+				delete(c.nonces, nonce)
+			}
+		}
+		c.mu.Unlock()
+	}
+}
+
+type redisNonceCache struct {
+	client *redis.Client
+}
+
+// NewRedisNonceCache returns a NonceCache shared by every server instance
+// using the same Redis.
+func NewRedisNonceCache(client *redis.Client) NonceCache {
+	return &redisNonceCache{client: client}
+}
+
+func (c *redisNonceCache) Use(nonce string, expires time.Time) (bool, error) {
+	return c.client.SetNX(context.Background(), redisKeyPrefix+"nonce:"+nonce, 1, time.Until(expires)).Result()
+}
+
+// signatureMiddleware replaces authMiddleware when Opts.SigningSecret is set.
+// Signed requests have every scope.
+func (s *Server) signatureMiddleware(c *gin.Context) {
+	reason := s.verifySignature(c)
+	if reason != "" {
+		s.opts.Logger.Warn("Rejected signed request",
+			"path", c.Request.URL.Path,
+			"reason", reason,
+		)
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	c.Set(tokenContextKey, &APIToken{Name: signedTokenName, Scopes: AllScopes})
+	sloggin.AddCustomAttributes(c, slog.String("token", signedTokenName))
+	c.Next()
+}
+
+// verifySignature returns why the request is rejected, or an empty string.
+func (s *Server) verifySignature(c *gin.Context) string {
+	timestamp, err := strconv.ParseInt(c.GetHeader(HeaderTimestamp), 10, 64)
+	if err != nil {
+		return "invalid timestamp"
+	}
+	signedAt := time.Unix(timestamp, 0)
+	if skew := time.Since(signedAt).Abs(); skew > s.opts.SignatureMaxSkew {
+		return "timestamp outside of the allowed skew"
+	}
+	nonce := c.GetHeader(HeaderNonce)
+	if nonce == "" {
+		return "missing nonce"
+	}
+	signature, err := hex.DecodeString(c.GetHeader(HeaderSignature))
+	if err != nil {
+		return "invalid signature encoding"
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxSignedBodySize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return "body too large"
+		}
+		return "unreadable body"
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	expected, _ := hex.DecodeString(Signature(s.opts.SigningSecret, c.Request.Method, c.Request.URL.RequestURI(), body, timestamp, nonce))
+	if !hmac.Equal(signature, expected) {
+		return "signature mismatch"
+	}
+
+	// The nonce is only recorded for valid signatures, otherwise anyone could
+	// burn the nonces of legitimate requests.
+	unused, err := s.opts.NonceCache.Use(nonce, signedAt.Add(s.opts.SignatureMaxSkew))
+	if err != nil {
+		s.opts.Logger.Error("Could not record nonce", "error", err)
+		return "nonce cache unavailable"
+	}
+	if !unused {
+		return "nonce already used"
+	}
+	return ""
+}
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func signedTestRequest(secret []byte, body, nonce string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/v1/codes/issue", strings.NewReader(body))
+	timestamp := time.Now().Unix()
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderNonce, nonce)
+	req.Header.Set(HeaderSignature, Signature(secret, req.Method, req.URL.RequestURI(), []byte(body), timestamp, nonce))
+	return req
+}
+
+func TestSignedRequests(t *testing.T) {
+	secret := []byte("secret")
+	_, handler := newTestServerWithOpts(t, &Opts{SigningSecret: secret})
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, signedTestRequest(secret, `{"xuid":"1000"}`, "first"))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("signed request: status %d, body %s", rec.Code, rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, signedTestRequest(secret, `{"xuid":"1000"}`, "first"))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("replayed request: status %d, want 401", rec.Code)
+	}
+
+	// The body is refused before it is read in full, even when signed.
+	body := `{"xuid":"1001","gamertag":"` + strings.Repeat("a", maxSignedBodySize) + `"}`
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, signedTestRequest(secret, body, "second"))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("oversized request: status %d, want 401", rec.Code)
+	}
+}
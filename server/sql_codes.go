@@ -0,0 +1,190 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"sync"
+	"time"
+)
+
+type CodeData struct {
+	ID       uint `gorm:"primarykey"`
+	Code     string
+	XUID     string `gorm:"column:xuid"`
+	Gamertag string
+	Issued   time.Time
+	Expires  time.Time
+}
+
+func (CodeData) TableName() string {
+	return "codes"
+}
+
+func (c *CodeData) ToCodeInformation() *CodeInformation {
+	return &CodeInformation{
+		Code:     c.Code,
+		XUID:     c.XUID,
+		Gamertag: c.Gamertag,
+		Issued:   c.Issued,
+		Expires:  c.Expires,
+	}
+}
+
+type sqlCodeStore struct {
+	db  *gorm.DB
+	ttl time.Duration
+
+	mu       sync.Mutex
+	onExpire func(info *CodeInformation)
+}
+
+// NewSQLCodeStore returns a CodeStore that keeps codes in the codes table of
+// the given database, so outstanding codes survive restarts. The database is
+// expected to be migrated with MigrateUp. Expired rows are swept periodically.
+// A ttl that isn't positive means 15 minutes.
+func NewSQLCodeStore(db *gorm.DB, ttl time.Duration) CodeStore {
+	if ttl <= 0 {
+		ttl = defaultCodeTTL
+	}
+	s := &sqlCodeStore{
+		db:  db,
+		ttl: ttl,
+	}
+	go s.sweep(min(ttl, time.Minute))
+	return s
+}
+
+func (s *sqlCodeStore) SetExpiryHandler(handler func(info *CodeInformation)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onExpire = handler
+}
+
+func (s *sqlCodeStore) GetInformation(code string) (*CodeInformation, error) {
+	var data CodeData
+	err := s.db.First(&data, "code = ? AND expires > ?", code, time.Now()).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewApplicationError(ErrorCodeCodeNotFound, "Code doesn't exist")
+		}
+		return nil, err
+	}
+	return data.ToCodeInformation(), nil
+}
+
+func (s *sqlCodeStore) GetForXuid(xuid string) (*CodeInformation, error) {
+	return s.getForXuid(xuid, time.Now())
+}
+
+func (s *sqlCodeStore) getForXuid(xuid string, now time.Time) (*CodeInformation, error) {
+	var data CodeData
+	err := s.db.First(&data, "xuid = ? AND expires > ?", xuid, now).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewApplicationError(ErrorCodeNoCodeForXUID, "There is no code for this XUID")
+		}
+		return nil, err
+	}
+	return data.ToCodeInformation(), nil
+}
+
+// sqlIssueAttempts caps how often Issue retries on unique index conflicts.
+const sqlIssueAttempts = 10
+
+func (s *sqlCodeStore) Issue(xuid, gamertag string) (*CodeInformation, error) {
+	for attempt := 0; attempt < sqlIssueAttempts; attempt++ {
+		// Expired rows are deleted and live ones looked up with the same
+		// timestamp, so a row can't be both kept and ignored.
+		now := time.Now()
+		err := s.deleteExpired(now)
+		if err != nil {
+			return nil, err
+		}
+		existing, _ := s.getForXuid(xuid, now)
+		if existing != nil {
+			return nil, NewApplicationErrorf(ErrorCodeCodeAlreadyIssued, "Code %s is already issued", existing.Code)
+		}
+		generated, err := generateCode(6)
+		if err != nil {
+			return nil, err
+		}
+		data := CodeData{
+			Code:     generated,
+			XUID:     xuid,
+			Gamertag: gamertag,
+			Issued:   now,
+			Expires:  now.Add(s.ttl),
+		}
+		err = s.db.Create(&data).Error
+		if err == nil {
+			return data.ToCodeInformation(), nil
+		}
+		// The duplicate may be either the code or the XUID, the next
+		// attempt tells them apart.
+		if !isDuplicateKeyError(s.db, err) {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("failed to issue a code for %s after %d attempts", xuid, sqlIssueAttempts)
+}
+
+func (s *sqlCodeStore) Revoke(code string) error {
+	result := s.db.Delete(&CodeData{}, "code = ?", code)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return NewApplicationError(ErrorCodeCodeNotFound, "Code doesn't exist")
+	}
+	return nil
+}
+
+func (s *sqlCodeStore) List() ([]*CodeInformation, error) {
+	var data []CodeData
+	err := s.db.Order("issued").Find(&data, "expires > ?", time.Now()).Error
+	if err != nil {
+		return nil, err
+	}
+	codes := make([]*CodeInformation, 0, len(data))
+	for _, d := range data {
+		codes = append(codes, d.ToCodeInformation())
+	}
+	return codes, nil
+}
+
+// sweep periodically removes expired rows, so CodeExpired is published even
+// when nobody issues codes.
+func (s *sqlCodeStore) sweep(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		// Errors are retried on the next tick.
+		_ = s.deleteExpired(now)
+	}
+}
+
+// deleteExpired removes expired rows, which would otherwise keep the unique
+// indexes occupied.
+func (s *sqlCodeStore) deleteExpired(now time.Time) error {
+	var expired []CodeData
+	err := s.db.Find(&expired, "expires <= ?", now).Error
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	onExpire := s.onExpire
+	s.mu.Unlock()
+	// Rows are deleted one by one, another instance may remove some of them
+	// first and only the instance that deleted a row reports it.
+	for _, data := range expired {
+		result := s.db.Delete(&CodeData{}, "id = ? AND expires <= ?", data.ID, now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if onExpire != nil && result.RowsAffected == 1 {
+			onExpire(data.ToCodeInformation())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestSQLCodeStore(t *testing.T, ttl time.Duration) CodeStore {
+	t.Helper()
+	db, err := OpenDatabase(DatabaseConfig{
+		Driver: DriverSQLite,
+		DSN:    "file:" + strings.ReplaceAll(t.Name(), "/", "_") + "?mode=memory&cache=shared",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := MigrateUp(db); err != nil {
+		t.Fatal(err)
+	}
+	return NewSQLCodeStore(db, ttl)
+}
+
+func TestSQLCodeStoreIssueAfterExpiry(t *testing.T) {
+	store := newTestSQLCodeStore(t, 50*time.Millisecond)
+	first, err := store.Issue("1000", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Issue("1000", ""); errorCode(err) != ErrorCodeCodeAlreadyIssued {
+		t.Fatalf("Issue with a live code: %v", err)
+	}
+	time.Sleep(60 * time.Millisecond)
+	second, err := store.Issue("1000", "")
+	if err != nil {
+		t.Fatalf("Issue after expiry: %v", err)
+	}
+	if second.Code == first.Code {
+		t.Fatal("Issue after expiry returned the expired code")
+	}
+}
+
+func TestSQLCodeStoreReportsExpiryOnce(t *testing.T) {
+	first := newTestSQLCodeStore(t, 50*time.Millisecond)
+	// A second instance sharing the database sweeps the same rows.
+	second := NewSQLCodeStore(first.(*sqlCodeStore).db, 50*time.Millisecond)
+	var mu sync.Mutex
+	var reported []string
+	for _, store := range []CodeStore{first, second} {
+		store.(ExpiringCodeStore).SetExpiryHandler(func(info *CodeInformation) {
+			mu.Lock()
+			defer mu.Unlock()
+			reported = append(reported, info.Code)
+		})
+	}
+	var issued []string
+	for _, xuid := range []string{"1000", "1001", "1002"} {
+		info, err := first.Issue(xuid, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		issued = append(issued, info.Code)
+	}
+	time.Sleep(200 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	slices.Sort(issued)
+	slices.Sort(reported)
+	if !slices.Equal(issued, reported) {
+		t.Fatalf("reported %v as expired, want %v", reported, issued)
+	}
+}
+
+func TestSQLCodeStoreDefaultTTL(t *testing.T) {
+	// A zero TTL used to crash the sweep ticker.
+	store := newTestSQLCodeStore(t, 0)
+	info, err := store.Issue("1000", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ttl := info.Expires.Sub(info.Issued); ttl != defaultCodeTTL {
+		t.Fatalf("code valid for %s, want %s", ttl, defaultCodeTTL)
+	}
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"errors"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+type TokenData struct {
+	ID   uint `gorm:"primarykey"`
+	Name string
+	Hash string
+	// Scopes are separated by spaces.
+	Scopes  string
+	Created time.Time
+}
+
+func (TokenData) TableName() string {
+	return "api_tokens"
+}
+
+func (t *TokenData) ToAPIToken() *APIToken {
+	return &APIToken{
+		Name:    t.Name,
+		Scopes:  strings.Fields(t.Scopes),
+		Created: t.Created,
+	}
+}
+
+type sqlTokenStore struct {
+	db *gorm.DB
+}
+
+// NewSQLTokenStore returns a TokenStore that keeps tokens in the api_tokens
+// table of the given database. The database is expected to be migrated with
+// MigrateUp.
+func NewSQLTokenStore(db *gorm.DB) TokenStore {
+	return &sqlTokenStore{db: db}
+}
+
+func (s *sqlTokenStore) Create(token *APIToken, hash string) error {
+	err := s.db.Create(&TokenData{
+		Name:    token.Name,
+		Hash:    hash,
+		Scopes:  strings.Join(token.Scopes, " "),
+		Created: token.Created,
+	}).Error
+	if err != nil {
+		if isDuplicateKeyError(s.db, err) {
+			return NewApplicationErrorf(ErrorCodeTokenAlreadyExists, "Token %s already exists", token.Name)
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *sqlTokenStore) GetByHash(hash string) (*APIToken, error) {
+	var data TokenData
+	err := s.db.First(&data, "hash = ?", hash).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewApplicationError(ErrorCodeTokenNotFound, "Token not found")
+		}
+		return nil, err
+	}
+	return data.ToAPIToken(), nil
+}
+
+func (s *sqlTokenStore) List() ([]*APIToken, error) {
+	var data []TokenData
+	err := s.db.Order("name").Find(&data).Error
+	if err != nil {
+		return nil, err
+	}
+	tokens := make([]*APIToken, 0, len(data))
+	for _, d := range data {
+		tokens = append(tokens, d.ToAPIToken())
+	}
+	return tokens, nil
+}
+
+func (s *sqlTokenStore) Delete(name string) error {
+	result := s.db.Delete(&TokenData{}, "name = ?", name)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return NewApplicationError(ErrorCodeTokenNotFound, "Token not found")
+	}
+	return nil
+}
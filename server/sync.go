@@ -0,0 +1,129 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"slices"
+)
+
+// SyncCommands makes the commands registered in the guild, or globally when
+// guildId is empty, match the ones added to the bot. Unchanged commands are
+// left alone, changed ones are edited in place and commands that are no
+// longer added are deleted.
+func (b *Bot) SyncCommands(guildId string) error {
+	b.mu.RLock()
+	desired := slices.Clone(b.commands)
+	b.mu.RUnlock()
+
+	appId := b.api.State.User.ID
+	existing, err := b.api.ApplicationCommands(appId, guildId)
+	if err != nil {
+		return err
+	}
+	existingByName := make(map[string]*discordgo.ApplicationCommand, len(existing))
+	for _, cmd := range existing {
+		existingByName[cmd.Name] = cmd
+	}
+
+	var errs []error
+	registered := make([]*discordgo.ApplicationCommand, 0, len(desired))
+	for _, cmd := range desired {
+		current, ok := existingByName[cmd.Name]
+		delete(existingByName, cmd.Name)
+		switch {
+		case !ok:
+			created, err := b.api.ApplicationCommandCreate(appId, guildId, cmd)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("create command %s: %w", cmd.Name, err))
+				continue
+			}
+			registered = append(registered, created)
+		case commandChanged(cmd, current):
+			updated, err := b.api.ApplicationCommandEdit(appId, guildId, current.ID, cmd)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("update command %s: %w", cmd.Name, err))
+				continue
+			}
+			registered = append(registered, updated)
+		default:
+			registered = append(registered, current)
+		}
+	}
+	for _, stale := range existingByName {
+		err := b.api.ApplicationCommandDelete(appId, guildId, stale.ID)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("delete command %s: %w", stale.Name, err))
+		}
+	}
+
+	b.mu.Lock()
+	b.cmds = registered
+	b.guildId = guildId
+	b.mu.Unlock()
+	return errors.Join(errs...)
+}
+
+// Close closes the discord session. With deregister set, the commands
+// registered by SyncCommands are deleted first.
+func (b *Bot) Close(deregister bool) error {
+	var errs []error
+	if deregister {
+		b.mu.Lock()
+		cmds, guildId := b.cmds, b.guildId
+		b.cmds = nil
+		b.mu.Unlock()
+		for _, cmd := range cmds {
+			err := b.api.ApplicationCommandDelete(b.api.State.User.ID, guildId, cmd.ID)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("delete command %s: %w", cmd.Name, err))
+			}
+		}
+	}
+	errs = append(errs, b.api.Close())
+	return errors.Join(errs...)
+}
+
+// commandChanged compares the fields of a command that can be set through the
+// bot. Fields left unset on the desired command are filled with their discord
+// defaults, so they don't count as changes.
+func commandChanged(desired, current *discordgo.ApplicationCommand) bool {
+	want := *desired
+	if want.Type == 0 {
+		want.Type = discordgo.ChatApplicationCommand
+	}
+	if want.Contexts == nil {
+		want.Contexts = current.Contexts
+	}
+	if want.IntegrationTypes == nil {
+		want.IntegrationTypes = current.IntegrationTypes
+	}
+	if want.DMPermission == nil {
+		want.DMPermission = current.DMPermission
+	}
+	if want.NSFW == nil {
+		want.NSFW = current.NSFW
+	}
+	return !sameCommandDefinition(&want, current)
+}
+
+func sameCommandDefinition(a, b *discordgo.ApplicationCommand) bool {
+	definition := func(cmd *discordgo.ApplicationCommand) []byte {
+		raw, _ := json.Marshal(&discordgo.ApplicationCommand{
+			Type:                     cmd.Type,
+			Name:                     cmd.Name,
+			NameLocalizations:        cmd.NameLocalizations,
+			Description:              cmd.Description,
+			DescriptionLocalizations: cmd.DescriptionLocalizations,
+			Options:                  cmd.Options,
+			DefaultMemberPermissions: cmd.DefaultMemberPermissions,
+			DMPermission:             cmd.DMPermission,
+			NSFW:                     cmd.NSFW,
+			Contexts:                 cmd.Contexts,
+			IntegrationTypes:         cmd.IntegrationTypes,
+		})
+		return raw
+	}
+	return string(definition(a)) == string(definition(b))
+}
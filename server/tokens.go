@@ -0,0 +1,134 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Scopes limit what an API token may do.
+const (
+	ScopeCodesIssue   = "codes:issue"
+	ScopeCodesRead    = "codes:read"
+	ScopeCodesRevoke  = "codes:revoke"
+	ScopeUsersRead    = "users:read"
+	ScopeUsersWrite   = "users:write"
+	ScopeTokensManage = "tokens:manage"
+)
+
+// AllScopes lists every known scope.
+var AllScopes = []string{
+	ScopeCodesIssue,
+	ScopeCodesRead,
+	ScopeCodesRevoke,
+	ScopeUsersRead,
+	ScopeUsersWrite,
+	ScopeTokensManage,
+}
+
+// rootTokenName is the name of the access token passed to NewServer, which
+// has every scope.
+const rootTokenName = "root"
+
+type APIToken struct {
+	Name    string    `json:"name"`
+	Scopes  []string  `json:"scopes"`
+	Created time.Time `json:"created"`
+}
+
+func (t *APIToken) HasScope(scope string) bool {
+	return slices.Contains(t.Scopes, scope)
+}
+
+// TokenStore keeps API tokens. Only hashes of the secrets are stored, see
+// hashToken.
+type TokenStore interface {
+	Create(token *APIToken, hash string) error
+	GetByHash(hash string) (*APIToken, error)
+	// List returns every token ordered by name.
+	List() ([]*APIToken, error)
+	Delete(name string) error
+}
+
+type defaultTokenStore struct {
+	mu     sync.RWMutex
+	tokens map[string]*APIToken
+	hashes map[string]string
+}
+
+func newDefaultTokenStore() TokenStore {
+	return &defaultTokenStore{
+		tokens: make(map[string]*APIToken),
+		hashes: make(map[string]string),
+	}
+}
+
+func (s *defaultTokenStore) Create(token *APIToken, hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.tokens[token.Name]; exists {
+		return NewApplicationErrorf(ErrorCodeTokenAlreadyExists, "Token %s already exists", token.Name)
+	}
+	s.tokens[token.Name] = token
+	s.hashes[hash] = token.Name
+	return nil
+}
+
+func (s *defaultTokenStore) GetByHash(hash string) (*APIToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	name, exists := s.hashes[hash]
+	if !exists {
+		return nil, NewApplicationError(ErrorCodeTokenNotFound, "Token not found")
+	}
+	return s.tokens[name], nil
+}
+
+func (s *defaultTokenStore) List() ([]*APIToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	tokens := make([]*APIToken, 0, len(s.tokens))
+	for _, token := range s.tokens {
+		tokens = append(tokens, token)
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].Name < tokens[j].Name
+	})
+	return tokens, nil
+}
+
+func (s *defaultTokenStore) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.tokens[name]; !exists {
+		return NewApplicationError(ErrorCodeTokenNotFound, "Token not found")
+	}
+	delete(s.tokens, name)
+	for hash, tokenName := range s.hashes {
+		if tokenName == name {
+			delete(s.hashes, hash)
+		}
+	}
+	return nil
+}
+
+// generateToken returns a random secret. Secrets have 256 bits of entropy, so
+// a plain SHA-256 is enough to store them.
+func generateToken() (string, error) {
+	buffer := make([]byte, 32)
+	_, err := rand.Read(buffer)
+	if err != nil {
+		return "", err
+	}
+	return "dfd_" + base64.RawURLEncoding.EncodeToString(buffer), nil
+}
+
+func hashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"github.com/bwmarrin/discordgo"
+)
+
+// unbind asks for confirmation before the binding is removed by unbindButton.
+func (b *Bot) unbind(i *discordgo.InteractionCreate, options map[string]*discordgo.ApplicationCommandInteractionDataOption) *discordgo.InteractionResponseData {
+	lang := interactionLanguage(i)
+	user, err := b.service.GetUserByDiscord(invokingUser(i).ID)
+	if err != nil {
+		return errorResponse(lang, err)
+	}
+	response := userEmbedResponse(lang, tr(lang, "unbind_confirm"), colorDanger, user)
+	response.Components = []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.Button{
+					Label:    tr(lang, "button_unbind"),
+					Style:    discordgo.DangerButton,
+					CustomID: "unbind:confirm",
+				},
+				discordgo.Button{
+					Label:    tr(lang, "button_cancel"),
+					Style:    discordgo.SecondaryButton,
+					CustomID: "unbind:cancel",
+				},
+			},
+		},
+	}
+	return response
+}
+
+func (b *Bot) unbindButton(i *discordgo.InteractionCreate, data discordgo.MessageComponentInteractionData) *discordgo.InteractionResponse {
+	lang := interactionLanguage(i)
+	if data.CustomID != "unbind:confirm" {
+		return updateResponse(messageResponse(tr(lang, "unbind_cancelled")))
+	}
+	discordId := invokingUser(i).ID
+	user, err := b.service.GetUserByDiscord(discordId)
+	if err != nil {
+		return updateResponse(errorResponse(lang, err))
+	}
+	err = b.service.DeleteUserByDiscord(discordId)
+	if err != nil {
+		return updateResponse(errorResponse(lang, err))
+	}
+	return updateResponse(userEmbedResponse(lang, tr(lang, "unbind_removed"), colorSuccess, user))
+}
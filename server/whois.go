@@ -0,0 +1,48 @@
+package server
+
+import (
+	"github.com/bwmarrin/discordgo"
+	"slices"
+)
+
+func (b *Bot) whois(i *discordgo.InteractionCreate, options map[string]*discordgo.ApplicationCommandInteractionDataOption) *discordgo.InteractionResponseData {
+	lang := interactionLanguage(i)
+	if !b.isStaff(i.Member) {
+		return messageResponse(tr(lang, "whois_forbidden"))
+	}
+	userOpt, byUser := options["user"]
+	gamertagOpt, byGamertag := options["gamertag"]
+	if byUser == byGamertag {
+		return messageResponse(tr(lang, "whois_usage"))
+	}
+
+	var user *User
+	var err error
+	if byUser {
+		user, err = b.service.GetUserByDiscord(userOpt.UserValue(nil).ID)
+	} else {
+		user, err = b.service.GetUserByGamertag(gamertagOpt.StringValue())
+	}
+	if err != nil {
+		return errorResponse(lang, err)
+	}
+	return userEmbedResponse(lang, tr(lang, "whois_title"), colorInfo, user)
+}
+
+func (b *Bot) profile(i *discordgo.InteractionCreate, options map[string]*discordgo.ApplicationCommandInteractionDataOption) *discordgo.InteractionResponseData {
+	lang := interactionLanguage(i)
+	user, err := b.service.GetUserByDiscord(invokingUser(i).ID)
+	if err != nil {
+		return errorResponse(lang, err)
+	}
+	return userEmbedResponse(lang, tr(lang, "whois_title"), colorInfo, user)
+}
+
+// isStaff reports whether the member has Opts.StaffRole. Without a role the
+// command's default Moderate Members permission decides instead.
+func (b *Bot) isStaff(member *discordgo.Member) bool {
+	if b.opts.StaffRole == "" {
+		return true
+	}
+	return member != nil && slices.Contains(member.Roles, b.opts.StaffRole)
+}